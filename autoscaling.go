@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kafkaPackage is the connection package whose connections are Kafka topics
+// that KEDA can scale on.
+const kafkaPackage = "topological-kafka"
+
+const targetCPUUtilization = 80
+
+// KafkaTrigger is a Kafka input of a stage that it can scale on by consumer
+// group lag, with the config values its topic and brokers are read from.
+type KafkaTrigger struct {
+	ConnectionID     string
+	BootstrapServers ConfigValue
+	Topic            ConfigValue
+	ConsumerGroup    string
+}
+
+func isKafkaConnection(connection Connection) bool {
+	_, ok := connection.Dependencies[kafkaPackage]
+	return ok
+}
+
+// isKedaScalar is true for config values a trigger parameter can take: those
+// read from the environment and literal strings, numbers and booleans.
+func isKedaScalar(value ConfigValue) bool {
+	switch value.Kind {
+	case ConfigKindEnv, ConfigKindSecret:
+		return true
+	case ConfigKindLiteral:
+		switch value.Literal.(type) {
+		case string, float64, int, int64, bool:
+			return true
+		}
+	}
+
+	return false
+}
+
+// kafkaTriggers lists the Kafka connections the nodes of a deployment read
+// from that declare both a topic and an endpoint as single values.
+func kafkaTriggers(deploymentID string, deployment Deployment, topology Topology, environment Environment) (triggers []KafkaTrigger) {
+	inputs := map[string]bool{}
+	for _, nodeId := range deployment.Nodes {
+		for _, connectionId := range topology.Nodes[nodeId].Inputs {
+			inputs[connectionId] = true
+		}
+	}
+
+	for _, connectionId := range sortedKeys(inputs) {
+		connection := environment.Connections[connectionId]
+		if !isKafkaConnection(connection) {
+			continue
+		}
+
+		values, _ := ParseConfig(connection.Config)
+		endpoint, hasEndpoint := values["endpoint"]
+		topic, hasTopic := values["topic"]
+		if !hasEndpoint || !hasTopic || !isKedaScalar(endpoint) || !isKedaScalar(topic) {
+			continue
+		}
+
+		triggers = append(triggers, KafkaTrigger{
+			ConnectionID:     connectionId,
+			BootstrapServers: endpoint,
+			Topic:            topic,
+			ConsumerGroup:    deploymentID,
+		})
+	}
+
+	return triggers
+}
+
+// Autoscales is true for stages that may run more than their minimum number
+// of replicas.
+func (s KubernetesStage) Autoscales() bool {
+	return s.MaxReplicas > s.Replicas
+}
+
+// ScalesOnLag is true for autoscaling stages that opted into scaling on the
+// consumer lag of their Kafka inputs with KEDA instead of on CPU.
+func (s KubernetesStage) ScalesOnLag() bool {
+	return s.Autoscales() && s.LagThreshold > 0 && len(s.KafkaTriggers) > 0
+}
+
+// hpaMinReplicas is the minimum of a stage's HPA, which autoscaling/v2 only
+// lets go down to 0 behind a feature gate.
+func hpaMinReplicas(stage KubernetesStage) int32 {
+	if stage.Replicas < 1 {
+		return 1
+	}
+
+	return stage.Replicas
+}
+
+func FillHorizontalPodAutoscaler(stage KubernetesStage) string {
+	return fmt.Sprintf(`apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: %[1]s
+  minReplicas: %[3]d
+  maxReplicas: %[4]d
+  metrics:
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: %[5]d
+`, stage.Name, stage.Namespace, hpaMinReplicas(stage), stage.MaxReplicas, targetCPUUtilization)
+}
+
+// kedaParameter renders a trigger parameter either as a literal or, for
+// values read from the environment, as the *FromEnv parameter that makes
+// KEDA read it from the scaled container's environment.
+func kedaParameter(name string, value ConfigValue) string {
+	if envName := value.EnvName(); envName != "" {
+		return fmt.Sprintf("        %sFromEnv: %s", name, envName)
+	}
+
+	return fmt.Sprintf("        %s: %s", name, jsonLiteral(fmt.Sprint(value.Literal)))
+}
+
+// scaledObjectTriggers renders the Kafka triggers of a stage's ScaledObject.
+func scaledObjectTriggers(stage KubernetesStage) string {
+	triggers := []string{}
+	for _, trigger := range stage.KafkaTriggers {
+		triggers = append(triggers, strings.Join([]string{
+			"    - type: kafka",
+			"      metadata:",
+			kedaParameter("bootstrapServers", trigger.BootstrapServers),
+			kedaParameter("topic", trigger.Topic),
+			fmt.Sprintf("        consumerGroup: %s", jsonLiteral(trigger.ConsumerGroup)),
+			fmt.Sprintf(`        lagThreshold: "%d"`, stage.LagThreshold),
+		}, "\n"))
+	}
+
+	return strings.Join(triggers, "\n")
+}
+
+func FillScaledObject(stage KubernetesStage) string {
+	return fmt.Sprintf(`apiVersion: keda.sh/v1alpha1
+kind: ScaledObject
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+spec:
+  scaleTargetRef:
+    name: %[1]s
+  minReplicaCount: %[3]d
+  maxReplicaCount: %[4]d
+  triggers:
+%[5]s
+`, stage.Name, stage.Namespace, stage.Replicas, stage.MaxReplicas, scaledObjectTriggers(stage))
+}
+
+// autoscalingManifests returns the autoscaler of a stage by file name, if it
+// autoscales: a KEDA ScaledObject when it scales on lag, else an HPA.
+func autoscalingManifests(stage KubernetesStage) map[string]string {
+	switch {
+	case stage.ScalesOnLag():
+		return map[string]string{"scaledobject.yaml": FillScaledObject(stage)}
+	case stage.Autoscales():
+		return map[string]string{"hpa.yaml": FillHorizontalPodAutoscaler(stage)}
+	default:
+		return map[string]string{}
+	}
+}
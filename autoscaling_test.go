@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedPredictArrivalsScaledObject = `apiVersion: keda.sh/v1alpha1
+kind: ScaledObject
+metadata:
+  name: predict-arrivals
+  namespace: data-pipeline
+spec:
+  scaleTargetRef:
+    name: predict-arrivals
+  minReplicaCount: 1
+  maxReplicaCount: 8
+  triggers:
+    - type: kafka
+      metadata:
+        bootstrapServersFromEnv: KAFKA_ENDPOINT
+        topicFromEnv: LOCATIONS_TOPIC
+        consumerGroup: "predict-arrivals"
+        lagThreshold: "100"
+`
+
+const expectedWriteLocationsHorizontalPodAutoscaler = `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: write-locations
+  namespace: data-pipeline
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: write-locations
+  minReplicas: 1
+  maxReplicas: 3
+  metrics:
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: 80
+`
+
+func TestAutoscalingManifests(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/autoscaling.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	predictArrivals := autoscalingManifests(builder.ResolveKubernetesStage("predict-arrivals"))
+	if predictArrivals["scaledobject.yaml"] != expectedPredictArrivalsScaledObject {
+		t.Errorf("scaledobject.yaml did not match:-->%s<-- vs. -->%s<--", predictArrivals["scaledobject.yaml"], expectedPredictArrivalsScaledObject)
+	}
+
+	writeLocations := autoscalingManifests(builder.ResolveKubernetesStage("write-locations"))
+	if writeLocations["hpa.yaml"] != expectedWriteLocationsHorizontalPodAutoscaler {
+		t.Errorf("hpa.yaml did not match:-->%s<-- vs. -->%s<--", writeLocations["hpa.yaml"], expectedWriteLocationsHorizontalPodAutoscaler)
+	}
+
+	if notifyArrivals := autoscalingManifests(builder.ResolveKubernetesStage("notify-arrivals")); len(notifyArrivals) != 0 {
+		t.Errorf("notify-arrivals should not autoscale, got: %v", notifyArrivals)
+	}
+}
+
+func TestValidateReplicas(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/autoscaling.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	notifyArrivals := builder.Environment.Deployments["notify-arrivals"]
+	notifyArrivals.Replicas.Min = 2
+	notifyArrivals.Replicas.Max = 1
+	builder.Environment.Deployments["notify-arrivals"] = notifyArrivals
+
+	diagnostics := NewValidator(builder.Topology, builder.Environment).checkReplicas()
+
+	expectedDiagnostics := []string{
+		`deployments.notify-arrivals.replicas.max: replicas.max 1 is less than replicas.min 2`,
+		`deployments.predict-arrivals.replicas.max: replicas.max 8 exceeds the 4 partitions of connection "locations", so at most 4 replicas will receive messages`,
+	}
+
+	if len(diagnostics) != len(expectedDiagnostics) {
+		t.Errorf("expected %d diagnostics, got %d: %s", len(expectedDiagnostics), len(diagnostics), diagnostics)
+	}
+
+	for idx, expectedDiagnostic := range expectedDiagnostics {
+		if idx >= len(diagnostics) {
+			break
+		}
+		if diagnostics[idx].String() != expectedDiagnostic {
+			t.Errorf("diagnostic %d did not match:-->%s<-- vs. -->%s<--", idx, diagnostics[idx], expectedDiagnostic)
+		}
+	}
+
+	if len(diagnostics) == 2 && (diagnostics[0].Severity != SeverityError || diagnostics[1].Severity != SeverityWarning) {
+		t.Errorf("expected an error and a warning, got: %s", diagnostics)
+	}
+}
+
+func TestAutoscalingMinimums(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/autoscaling.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	// an HPA cannot scale to zero, while KEDA can
+	for _, deploymentId := range []string{"predict-arrivals", "write-locations"} {
+		deployment := builder.Environment.Deployments[deploymentId]
+		deployment.Replicas.Min = 0
+		builder.Environment.Deployments[deploymentId] = deployment
+	}
+
+	hpa := autoscalingManifests(builder.ResolveKubernetesStage("write-locations"))["hpa.yaml"]
+	if !strings.Contains(hpa, "minReplicas: 1\n") {
+		t.Errorf("hpa.yaml should not go below one replica: %s", hpa)
+	}
+
+	scaledObject := autoscalingManifests(builder.ResolveKubernetesStage("predict-arrivals"))["scaledobject.yaml"]
+	if !strings.Contains(scaledObject, "minReplicaCount: 0\n") {
+		t.Errorf("scaledobject.yaml should scale to zero: %s", scaledObject)
+	}
+}
+
+func TestKafkaTriggersRejectStructuredValues(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/autoscaling.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	locations := builder.Environment.Connections["locations"]
+	locations.Config["topic"] = map[string]interface{}{"value": []interface{}{"locations", "locations-replay"}}
+	builder.Environment.Connections["locations"] = locations
+
+	if triggers := kafkaTriggers("predict-arrivals", builder.Environment.Deployments["predict-arrivals"], builder.Topology, builder.Environment); len(triggers) != 0 {
+		t.Errorf("a topic that is not a single value should not become a trigger, got: %v", triggers)
+	}
+
+	diagnostics := NewValidator(builder.Topology, builder.Environment).checkReplicas()
+	expectedDiagnostic := `connections.locations.config.topic: topic of connection "locations" must be a single value for deployment "predict-arrivals" to scale on its lag`
+	if !diagnostics.HasCode(CodeInvalidConfig) || !strings.Contains(diagnostics.Error(), expectedDiagnostic) {
+		t.Errorf("expected -->%s<--, got: %s", expectedDiagnostic, diagnostics)
+	}
+}
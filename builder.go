@@ -1,8 +1,6 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -17,6 +15,19 @@ type Builder struct {
 
 	Topology    Topology
 	Environment Environment
+
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+	Diagnostics       Diagnostics
+
+	// Variables and VariableFiles supply ${vars.name} values from the command
+	// line, overriding the environment's own vars block.
+	Variables     map[string]interface{}
+	VariableFiles []string
+
+	// EnvironmentDocument is the environment as merged from its overlays and
+	// interpolated, before it is decoded into Environment.
+	EnvironmentDocument interface{}
 }
 
 func NewBuilder(topologyPath string, environmentPath string) *Builder {
@@ -26,83 +37,174 @@ func NewBuilder(topologyPath string, environmentPath string) *Builder {
 	}
 }
 
-func (b *Builder) LoadTopology() (topology *Topology, err error) {
-	topologyContents, err := ioutil.ReadFile(b.TopologyPath)
-	if err != nil {
-		return nil, err
+// loadDefinition reads and decodes a JSON or YAML definition file into
+// target, recording a source map for it and any problems as diagnostics.
+func (b *Builder) loadDefinition(definitionPath string, target interface{}) (source *SourceMap, diagnostics Diagnostics) {
+	document, source, diagnostics := readDefinition(definitionPath)
+	if diagnostics.HasErrors() {
+		return source, diagnostics
 	}
 
-	err = json.Unmarshal(topologyContents, &b.Topology)
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Topology failed to unmarshal: %s", err))
-		return nil, err
+	diagnostics = append(diagnostics, decodeDefinition(document, source, target)...)
+
+	return source, diagnostics
+}
+
+func (b *Builder) LoadTopology() (topology *Topology, err error) {
+	source, diagnostics := b.loadDefinition(b.TopologyPath, &b.Topology)
+	b.TopologySource = source
+	b.Diagnostics = append(b.Diagnostics, diagnostics...)
+
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
 	}
 
 	return &b.Topology, nil
 }
 
 func (b *Builder) LoadEnvironment() (environment *Environment, err error) {
-	environmentContents, err := ioutil.ReadFile(b.EnvironmentPath)
-	if err != nil {
-		return nil, err
+	document, source, diagnostics := readEnvironmentDefinition(b.EnvironmentPath)
+	if !diagnostics.HasErrors() {
+		var interpolationDiagnostics Diagnostics
+		document, interpolationDiagnostics = b.interpolateEnvironment(document, source)
+		diagnostics = append(diagnostics, interpolationDiagnostics...)
+	}
+	if !diagnostics.HasErrors() {
+		diagnostics = append(diagnostics, decodeDefinition(document, source, &b.Environment)...)
 	}
 
-	err = json.Unmarshal(environmentContents, &b.Environment)
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Environment failed to unmarshal: %s", err))
-		return nil, err
+	b.EnvironmentDocument = document
+	b.EnvironmentSource = source
+	b.Diagnostics = append(b.Diagnostics, diagnostics...)
+
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
 	}
 
 	return &b.Environment, nil
 }
 
+// Load loads both the environment and topology, collecting the problems of
+// both rather than stopping at the first failure.
 func (b *Builder) Load() (err error) {
-	_, err = b.LoadEnvironment()
-	if err != nil {
-		return nil
+	b.Diagnostics = nil
+
+	b.LoadEnvironment()
+	b.LoadTopology()
+
+	if b.Diagnostics.HasErrors() {
+		return b.Diagnostics
 	}
 
-	_, err = b.LoadTopology()
-	return err
+	return nil
 }
 
-func (b *Builder) MakeBuilder(deploymentID string) (platformBuilder PlatformBuilder, err error) {
-	var platform string
+// Validate runs the static checks over the loaded definitions and adds their
+// diagnostics to the builder's.
+func (b *Builder) Validate() (diagnostics Diagnostics) {
+	validator := NewValidator(b.Topology, b.Environment)
+	validator.TopologySource = b.TopologySource
+	validator.EnvironmentSource = b.EnvironmentSource
+
+	diagnostics = validator.Validate()
+	diagnostics = append(diagnostics, b.validatePlatforms()...)
+	b.Diagnostics = append(b.Diagnostics, diagnostics...)
+
+	return diagnostics
+}
 
+// DeploymentPlatform is the platform shared by the processors of every node
+// of a deployment.
+func (b *Builder) DeploymentPlatform(deploymentID string) (platform string, err error) {
 	deployment := b.Environment.Deployments[deploymentID]
 
 	// check to make sure platform is the same across the nodes of the deployment
 	for nodeIdx, _ := range deployment.Nodes {
 		nodeId := deployment.Nodes[nodeIdx]
 		node, nodeExists := b.Topology.Nodes[nodeId]
+		nodePath := indexPath(joinPath(joinPath("deployments", deploymentID), "nodes"), nodeIdx)
 
 		if !nodeExists {
-			errString := fmt.Sprintf("no node named %s as found in deployment %s", nodeId, deploymentID)
-			return nil, errors.New(errString)
+			var diagnostics Diagnostics
+			diagnostics.Errorf(CodeUnknownNode, b.EnvironmentSource, nodePath, "no node named %s as found in deployment %s", nodeId, deploymentID)
+			return "", diagnostics
 		}
 
 		if platform != "" && node.Processor.Platform != platform {
-			errString := fmt.Sprintf("mismatched platforms: %s vs %s for deployment id %s", platform, node.Processor.Platform, deploymentID)
-			return nil, errors.New(errString)
+			var diagnostics Diagnostics
+			diagnostics.Errorf(CodeMismatchedPlatform, b.EnvironmentSource, nodePath, "mismatched platforms: %s vs %s for deployment id %s", platform, node.Processor.Platform, deploymentID)
+			return "", diagnostics
 		} else {
 			platform = node.Processor.Platform
 		}
 	}
 
-	switch platform {
-	case "node.js":
-		platformBuilder = &NodeJsPlatformBuilder{
-			DeploymentID: deploymentID,
-			Deployment:   deployment,
-			Topology:     b.Topology,
-			Environment:  b.Environment,
+	return platform, nil
+}
+
+func (b *Builder) platformContext(deploymentID string) PlatformContext {
+	return PlatformContext{
+		DeploymentID:      deploymentID,
+		Deployment:        b.Environment.Deployments[deploymentID],
+		Topology:          b.Topology,
+		Environment:       b.Environment,
+		TopologySource:    b.TopologySource,
+		EnvironmentSource: b.EnvironmentSource,
+		Diagnostics:       &b.Diagnostics,
+	}
+}
+
+// platformFactory finds the builder of a platform among the built in ones,
+// falling back to a topo-platform-<platform> plugin.
+func (b *Builder) platformFactory(platform string) (factory PlatformBuilderFactory, ok bool) {
+	if factory, ok = platformBuilders[platform]; ok {
+		return factory, true
+	}
+
+	if pluginPath, ok := findPlatformPlugin(platform, path.Dir(b.TopologyPath)); ok {
+		return pluginPlatformBuilderFactory(platform, pluginPath), true
+	}
+
+	return nil, false
+}
+
+// MakeBuilder creates the builder registered for the platform of a
+// deployment.
+func (b *Builder) MakeBuilder(deploymentID string) (platformBuilder PlatformBuilder, err error) {
+	platform, err := b.DeploymentPlatform(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := b.platformFactory(platform)
+	if !ok {
+		return nil, unknownPlatformError(platform, deploymentID)
+	}
+
+	return factory(b.platformContext(deploymentID)), nil
+}
+
+// validatePlatforms runs the checks of the platform builder of every
+// deployment. Deployments whose nodes are unknown or mix platforms are
+// skipped, as the validator reports those.
+func (b *Builder) validatePlatforms() (diagnostics Diagnostics) {
+	for _, deploymentID := range sortedDeploymentIds(b.Environment.Deployments) {
+		platform, err := b.DeploymentPlatform(deploymentID)
+		if err != nil {
+			continue
 		}
-	default:
-		errString := fmt.Sprintf("unknown platform %s", platform)
-		return nil, errors.New(errString)
+
+		factory, ok := b.platformFactory(platform)
+		if !ok {
+			nodeId := b.Environment.Deployments[deploymentID].Nodes[0]
+			diagnostics.Errorf(CodeUnknownPlatform, b.TopologySource, joinPath(joinPath("nodes", nodeId), "processor.platform"), "%s", unknownPlatformError(platform, deploymentID))
+			continue
+		}
+
+		diagnostics = append(diagnostics, factory(b.platformContext(deploymentID)).Validate()...)
 	}
 
-	return platformBuilder, nil
+	return diagnostics
 }
 
 func (b *Builder) BuildDeployment(deploymentID string) (err error) {
@@ -122,18 +224,35 @@ func (b *Builder) BuildDeployment(deploymentID string) (err error) {
 		return err
 	}
 
-	return nil
+	switch b.Environment.DeploymentTarget(deploymentID) {
+	case TargetKubernetesManifests:
+		return b.BuildManifests(deploymentID)
+	case TargetCompose:
+		// the whole tier runs from one docker-compose.yml written by Build
+		return nil
+	case TargetSystemd:
+		return b.BuildSystemd(deploymentID, platformBuilder.Image())
+	default:
+		return b.BuildChart(deploymentID)
+	}
+}
+
+// fail records an error that stopped the build as diagnostics, so that it
+// is reported like every other problem, and returns them.
+func (b *Builder) fail(err error) error {
+	diagnostics := errorDiagnostics(err)
+	b.Diagnostics = append(b.Diagnostics, diagnostics...)
+	return diagnostics
 }
 
 func (b *Builder) Build() error {
-	_, err := b.LoadTopology()
+	err := b.Load()
 	if err != nil {
 		return err
 	}
 
-	_, err = b.LoadEnvironment()
-	if err != nil {
-		return err
+	if diagnostics := b.Validate(); diagnostics.HasErrors() {
+		return diagnostics
 	}
 
 	// create build directory if it doesn't exist
@@ -146,17 +265,42 @@ func (b *Builder) Build() error {
 
 	err = os.Mkdir(tierDir, 0755)
 	if err != nil {
-		return err
+		return b.fail(err)
 	}
 
-	var deployAllScript string
-	for deploymentID := range b.Environment.Deployments {
+	deployAllScript := "#!/bin/bash\n\nset -e\n\ncd \"$(dirname \"$0\")\"\n\n"
+	for _, deploymentID := range sortedDeploymentIds(b.Environment.Deployments) {
 		err = b.BuildDeployment(deploymentID)
 		if err != nil {
-			return err
+			return b.fail(err)
+		}
+
+		switch b.Environment.DeploymentTarget(deploymentID) {
+		case TargetCompose:
+			// compose deployments are brought up together below
+		case TargetSystemd:
+			deployAllScript += fmt.Sprintf("(cd %s && ./install-stage)\n", deploymentID)
+		default:
+			deployAllScript += fmt.Sprintf("(cd %s && ./deploy-stage)\n", deploymentID)
+		}
+	}
+
+	if manifestDeployments := b.Environment.DeploymentsWithTarget(TargetKubernetesManifests); len(manifestDeployments) > 0 {
+		kustomization := FillTierKustomization(manifestDeployments)
+		if err = ioutil.WriteFile(path.Join(tierDir, "kustomization.yaml"), []byte(kustomization), 0644); err != nil {
+			return b.fail(err)
+		}
+	}
+
+	if len(b.Environment.DeploymentsWithTarget(TargetCompose)) > 0 {
+		if err = ioutil.WriteFile(path.Join(tierDir, "docker-compose.yml"), []byte(b.FillDockerCompose()), 0644); err != nil {
+			return b.fail(err)
+		}
+		if err = ioutil.WriteFile(path.Join(tierDir, ".env.example"), []byte(b.FillComposeEnvExample()), 0644); err != nil {
+			return b.fail(err)
 		}
 
-		deployAllScript += fmt.Sprintf("cd %s && ./deploy-stage && cd ..\n", deploymentID)
+		deployAllScript += "docker compose up --build --detach\n"
 	}
 
 	ioutil.WriteFile(path.Join(tierDir, "deploy-all"), []byte(deployAllScript), 0755)
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -98,3 +101,69 @@ func TestFillValuesYaml(t *testing.T) {
 		t.Errorf("stage.js did not match:-->%s<-- vs. -->%s<-- did not complete successfully.", valuesYamlString, expectedValuesYamlString)
 	}
 }
+
+const expectedHybridDeployAll = `#!/bin/bash
+
+set -e
+
+cd "$(dirname "$0")"
+
+(cd notify-arrivals && ./deploy-stage)
+(cd predict-arrivals && ./deploy-stage)
+docker compose up --build --detach
+`
+
+func TestBuildHybrid(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/hybrid.yaml")
+
+	err := builder.Build()
+	if err != nil {
+		t.Errorf("Build did not complete successfully: %s", err)
+	}
+
+	expectedItems := []string{
+		"build/hybrid/docker-compose.yml",
+		"build/hybrid/kustomization.yaml",
+		"build/hybrid/notify-arrivals/devops/kustomization.yaml",
+		"build/hybrid/predict-arrivals/devops/Chart.yaml",
+		"build/hybrid/write-locations/Dockerfile",
+	}
+
+	for _, item := range expectedItems {
+		if _, err := os.Stat(item); os.IsNotExist(err) {
+			t.Errorf("Build did not create expected file: %s", item)
+		}
+	}
+
+	if _, err := os.Stat("build/hybrid/write-locations/deploy-stage"); err == nil {
+		t.Errorf("Build should not create a deploy-stage for a compose deployment")
+	}
+
+	deployAllBytes, err := ioutil.ReadFile("build/hybrid/deploy-all")
+	if err != nil {
+		t.Errorf("Could not read deploy-all: %s", err)
+	}
+
+	if string(deployAllBytes) != expectedHybridDeployAll {
+		t.Errorf("deploy-all did not match:-->%s<-- vs. -->%s<--", deployAllBytes, expectedHybridDeployAll)
+	}
+
+	if kustomization := FillTierKustomization(builder.Environment.DeploymentsWithTarget(TargetKubernetesManifests)); kustomization != "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n  - notify-arrivals/devops\n" {
+		t.Errorf("kustomization should only list notify-arrivals:-->%s<--", kustomization)
+	}
+}
+
+func TestErrorDiagnostics(t *testing.T) {
+	_, err := ioutil.ReadFile("fixtures/missing.json")
+	if diagnostics := errorDiagnostics(err); len(diagnostics) != 1 || !diagnostics.HasCode(CodeIOError) {
+		t.Errorf("expected an io-error diagnostic, got: %v", diagnostics)
+	}
+
+	if diagnostics := errorDiagnostics(errors.New("no Build step")); len(diagnostics) != 1 || !diagnostics.HasCode(CodeBuildError) {
+		t.Errorf("expected a build-error diagnostic, got: %v", diagnostics)
+	}
+
+	if diagnostics := errorDiagnostics(unknownPlatformError("cobol", "write-locations")); len(diagnostics) != 1 || !diagnostics.HasCode(CodeUnknownPlatform) {
+		t.Errorf("expected an unknown-platform diagnostic, got: %v", diagnostics)
+	}
+}
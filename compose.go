@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StandIn is a local container that takes the place of the broker behind
+// every connection built on a given package, e.g. Redpanda for Kafka.
+type StandIn struct {
+	Service  string
+	Endpoint string
+	Compose  string
+}
+
+// standIns maps connection packages to the local brokers that stand in for
+// them when an environment sets standIns.
+var standIns = map[string]StandIn{
+	kafkaPackage: {
+		Service:  "redpanda",
+		Endpoint: "redpanda:9092",
+		Compose: `  redpanda:
+    image: docker.redpanda.com/redpandadata/redpanda:v23.3.5
+    command: redpanda start --mode dev-container --smp 1 --kafka-addr 0.0.0.0:9092 --advertise-kafka-addr redpanda:9092
+    ports:
+      - "9092:9092"`,
+	},
+}
+
+// composeCPUs converts a Kubernetes CPU quantity such as 250m into the number
+// of CPUs compose expects, e.g. 0.25.
+func composeCPUs(quantity string) string {
+	if strings.HasSuffix(quantity, "m") {
+		millis, err := strconv.ParseFloat(strings.TrimSuffix(quantity, "m"), 64)
+		if err != nil {
+			return quantity
+		}
+		return strconv.FormatFloat(millis/1000, 'f', -1, 64)
+	}
+
+	return quantity
+}
+
+// memoryUnits are the suffixes of Kubernetes memory quantities, decimal and
+// binary, with the number of bytes they stand for.
+var memoryUnits = map[string]float64{
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"P":  1e15,
+	"E":  1e18,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+	"Ei": 1 << 60,
+}
+
+// memoryBytes converts a Kubernetes memory quantity such as 1G or 0.5Gi into
+// a number of bytes, or "" when it is not a quantity.
+func memoryBytes(quantity string) string {
+	multiplier := 1.0
+	number := quantity
+	for _, suffixLength := range []int{2, 1} {
+		if len(quantity) <= suffixLength {
+			continue
+		}
+		if unit, ok := memoryUnits[quantity[len(quantity)-suffixLength:]]; ok {
+			multiplier = unit
+			number = quantity[:len(quantity)-suffixLength]
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(value*multiplier, 'f', 0, 64)
+}
+
+// composeMemoryUnit matches the binary quantities compose takes as they
+// are, e.g. 256Mi as 256m. compose reads its units as powers of 1024.
+var composeMemoryUnit = regexp.MustCompile(`^[0-9]+[KMG]i$`)
+
+// composeMemory converts a Kubernetes memory quantity such as 256Mi into the
+// byte value compose expects, e.g. 256m, and any other into bytes.
+func composeMemory(quantity string) string {
+	if composeMemoryUnit.MatchString(quantity) {
+		return strings.ToLower(strings.TrimSuffix(quantity, "i"))
+	}
+
+	return memoryBytes(quantity)
+}
+
+// deploymentStandIns returns the stand-ins for the connections of a
+// deployment, and the environment variables that must point at them because
+// they hold the endpoint of a stood-in connection.
+func deploymentStandIns(deployment Deployment, topology Topology, environment Environment) (services []string, endpoints map[string]string) {
+	endpoints = map[string]string{}
+	serviceSet := map[string]bool{}
+
+	for _, connectionId := range deploymentConnections(deployment, topology) {
+		connection := environment.Connections[connectionId]
+		for packageName := range connection.Dependencies {
+			standIn, ok := standIns[packageName]
+			if !ok {
+				continue
+			}
+
+			serviceSet[standIn.Service] = true
+
+			values, _ := ParseConfig(connection.Config)
+			if envName := values["endpoint"].EnvName(); envName != "" {
+				endpoints[envName] = standIn.Endpoint
+			}
+		}
+	}
+
+	return sortedKeys(serviceSet), endpoints
+}
+
+func (b *Builder) fillComposeService(deploymentID string) string {
+	deployment := b.Environment.Deployments[deploymentID]
+
+	environment := map[string]string{}
+	if deployment.LogSeverity != "" {
+		environment["LOG_SEVERITY"] = deployment.LogSeverity
+	}
+
+	var dependsOn []string
+	if b.Environment.StandIns {
+		var endpoints map[string]string
+		dependsOn, endpoints = deploymentStandIns(deployment, b.Topology, b.Environment)
+		for name, endpoint := range endpoints {
+			environment[name] = endpoint
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("  %s:", deploymentID),
+		fmt.Sprintf("    build: ./%s", deploymentID),
+		"    env_file: .env",
+	}
+
+	if len(environment) > 0 {
+		names := make([]string, 0, len(environment))
+		for name := range environment {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lines = append(lines, "    environment:")
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("      %s: %s", name, jsonLiteral(environment[name])))
+		}
+	}
+
+	if len(dependsOn) > 0 {
+		lines = append(lines, "    depends_on:")
+		for _, service := range dependsOn {
+			lines = append(lines, fmt.Sprintf("      - %s", service))
+		}
+	}
+
+	limits := []string{}
+	if deployment.CPU.Limit != "" {
+		limits = append(limits, fmt.Sprintf("          cpus: %s", jsonLiteral(composeCPUs(deployment.CPU.Limit))))
+	}
+	if deployment.Memory.Limit != "" {
+		limits = append(limits, fmt.Sprintf("          memory: %s", composeMemory(deployment.Memory.Limit)))
+	}
+
+	reservations := []string{}
+	if deployment.CPU.Request != "" {
+		reservations = append(reservations, fmt.Sprintf("          cpus: %s", jsonLiteral(composeCPUs(deployment.CPU.Request))))
+	}
+	if deployment.Memory.Request != "" {
+		reservations = append(reservations, fmt.Sprintf("          memory: %s", composeMemory(deployment.Memory.Request)))
+	}
+
+	if len(limits) > 0 || len(reservations) > 0 {
+		lines = append(lines, "    deploy:", "      resources:")
+		if len(limits) > 0 {
+			lines = append(lines, "        limits:")
+			lines = append(lines, limits...)
+		}
+		if len(reservations) > 0 {
+			lines = append(lines, "        reservations:")
+			lines = append(lines, reservations...)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FillDockerCompose renders a docker-compose.yml that runs every compose
+// deployment of the tier, built from its generated Dockerfile, plus the stand-ins for
+// their brokers when the environment asks for them.
+func (b *Builder) FillDockerCompose() string {
+	services := []string{}
+	standInServices := map[string]bool{}
+
+	for _, deploymentID := range b.Environment.DeploymentsWithTarget(TargetCompose) {
+		services = append(services, b.fillComposeService(deploymentID))
+
+		if b.Environment.StandIns {
+			dependsOn, _ := deploymentStandIns(b.Environment.Deployments[deploymentID], b.Topology, b.Environment)
+			for _, service := range dependsOn {
+				standInServices[service] = true
+			}
+		}
+	}
+
+	standInPackages := make([]string, 0, len(standIns))
+	for packageName := range standIns {
+		standInPackages = append(standInPackages, packageName)
+	}
+	sort.Strings(standInPackages)
+
+	for _, packageName := range standInPackages {
+		if standInServices[standIns[packageName].Service] {
+			services = append(services, standIns[packageName].Compose)
+		}
+	}
+
+	return fmt.Sprintf(`# runs the %s tier on this machine: copy .env.example to .env, fill it in and run
+# docker compose up --build
+services:
+%s
+`, b.Environment.Tier, strings.Join(services, "\n\n"))
+}
+
+// mergeEnvRequirements combines the requirements of several deployments,
+// which share one .env file when they run together.
+func mergeEnvRequirements(requirementLists ...[]EnvRequirement) []EnvRequirement {
+	merged := map[string]*EnvRequirement{}
+	for _, requirements := range requirementLists {
+		for _, requirement := range requirements {
+			existing, ok := merged[requirement.Name]
+			if !ok {
+				copied := requirement
+				copied.UsedBy = append([]EnvUsage{}, requirement.UsedBy...)
+				merged[requirement.Name] = &copied
+				continue
+			}
+
+			for _, usage := range requirement.UsedBy {
+				duplicate := false
+				for _, existingUsage := range existing.UsedBy {
+					if existingUsage == usage {
+						duplicate = true
+					}
+				}
+				if !duplicate {
+					existing.UsedBy = append(existing.UsedBy, usage)
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := []EnvRequirement{}
+	for _, name := range names {
+		sorted = append(sorted, *merged[name])
+	}
+
+	return sorted
+}
+
+// FillComposeEnvExample lists every variable the compose deployments of the
+// tier read, leaving out the endpoints that point at stand-ins.
+func (b *Builder) FillComposeEnvExample() string {
+	requirementLists := [][]EnvRequirement{}
+	standInEndpoints := map[string]bool{}
+
+	for _, deploymentID := range b.Environment.DeploymentsWithTarget(TargetCompose) {
+		deployment := b.Environment.Deployments[deploymentID]
+		requirementLists = append(requirementLists, collectEnvRequirements(deployment, b.Topology, b.Environment))
+
+		if b.Environment.StandIns {
+			_, endpoints := deploymentStandIns(deployment, b.Topology, b.Environment)
+			for name := range endpoints {
+				standInEndpoints[name] = true
+			}
+		}
+	}
+
+	requirements := []EnvRequirement{}
+	for _, requirement := range mergeEnvRequirements(requirementLists...) {
+		if !standInEndpoints[requirement.Name] {
+			requirements = append(requirements, requirement)
+		}
+	}
+
+	return fillEnvExample(fmt.Sprintf("# environment variables read by tier %s", b.Environment.Tier), requirements)
+}
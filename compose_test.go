@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedPredictArrivalsComposeService = `  predict-arrivals:
+    build: ./predict-arrivals
+    env_file: .env
+    environment:
+      KAFKA_ENDPOINT: "redpanda:9092"
+      LOG_SEVERITY: "info"
+    depends_on:
+      - redpanda
+    deploy:
+      resources:
+        limits:
+          cpus: "1"
+          memory: 512m
+        reservations:
+          cpus: "0.25"
+          memory: 256m`
+
+func TestFillDockerCompose(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/compose.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	service := builder.fillComposeService("predict-arrivals")
+	if service != expectedPredictArrivalsComposeService {
+		t.Errorf("compose service did not match:-->%s<-- vs. -->%s<--", service, expectedPredictArrivalsComposeService)
+	}
+
+	compose := builder.FillDockerCompose()
+	if strings.Count(compose, "  redpanda:\n") != 1 {
+		t.Errorf("expected a single redpanda stand-in in:-->%s<--", compose)
+	}
+
+	envExample := builder.FillComposeEnvExample()
+	if strings.Contains(envExample, "KAFKA_ENDPOINT") {
+		t.Errorf("endpoints served by stand-ins should not be in .env.example:-->%s<--", envExample)
+	}
+	if !strings.Contains(envExample, "LOCATIONS_TOPIC=") {
+		t.Errorf("expected LOCATIONS_TOPIC in .env.example:-->%s<--", envExample)
+	}
+
+	builder.Environment.StandIns = false
+	if compose := builder.FillDockerCompose(); strings.Contains(compose, "redpanda") {
+		t.Errorf("stand-ins should only be included when asked for:-->%s<--", compose)
+	}
+}
+
+func TestComposeResources(t *testing.T) {
+	quantities := [][]string{
+		{composeCPUs("250m"), "0.25"},
+		{composeCPUs("2"), "2"},
+		{composeMemory("256Mi"), "256m"},
+		{composeMemory("1Gi"), "1g"},
+		{composeMemory("1G"), "1000000000"},
+		{composeMemory("0.5Gi"), "536870912"},
+		{composeMemory("128974848"), "128974848"},
+	}
+
+	for _, quantity := range quantities {
+		if quantity[0] != quantity[1] {
+			t.Errorf("quantity did not match:-->%s<-- vs. -->%s<--", quantity[0], quantity[1])
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A config value of a connection or processor is one of:
+//
+//	"kafka-endpoint"                         shorthand for {"env": "KAFKA_ENDPOINT"}
+//	{"env": "KAFKA_ENDPOINT", "default": "x"} read from the environment at runtime
+//	{"value": 500}                            a literal of any JSON type
+//	{"secret": "cassandra/password"}          key password of secret cassandra
+//	{"batch": {"value": 500}, ...}            an object of nested config values
+//	[{"value": 1}, "other-endpoint"]          an array of config values
+//
+// Bare numbers, booleans and nulls are literals.
+type ConfigValue struct {
+	Kind string
+
+	Env        string
+	Default    interface{}
+	HasDefault bool
+
+	Literal interface{}
+
+	SecretName string
+	SecretKey  string
+
+	Fields map[string]ConfigValue
+	Items  []ConfigValue
+}
+
+const (
+	ConfigKindEnv     = "env"
+	ConfigKindLiteral = "value"
+	ConfigKindSecret  = "secret"
+	ConfigKindObject  = "object"
+	ConfigKindArray   = "array"
+)
+
+var envNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// envNamePattern is the environment variable names that can be read with
+// process.env.NAME and that Kubernetes and compose accept.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envVarName turns the shorthand name of a config value into the environment
+// variable it is read from, e.g. kafka-endpoint into KAFKA_ENDPOINT.
+func envVarName(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func hasOnlyKeys(valueMap map[string]interface{}, required string, optional ...string) bool {
+	if _, ok := valueMap[required]; !ok {
+		return false
+	}
+
+	for key := range valueMap {
+		if key == required {
+			continue
+		}
+
+		allowed := false
+		for _, optionalKey := range optional {
+			if key == optionalKey {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConfigError is a config value that could not be interpreted. Path is
+// relative to the config map, e.g. batch.size or endpoints[1].
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ParseConfigValue interprets a raw config value from a definition file.
+func ParseConfigValue(raw interface{}) (value ConfigValue, err error) {
+	return parseConfigValue(raw, "")
+}
+
+// ParseConfig interprets every value of a connection or processor config.
+func ParseConfig(config map[string]interface{}) (values map[string]ConfigValue, err error) {
+	return parseConfigFields(config, "")
+}
+
+func parseConfigFields(config map[string]interface{}, path string) (values map[string]ConfigValue, err error) {
+	values = map[string]ConfigValue{}
+	for _, key := range sortedConfigKeys(config) {
+		value, err := parseConfigValue(config[key], joinPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+func parseConfigValue(raw interface{}, path string) (value ConfigValue, err error) {
+	switch typedRaw := raw.(type) {
+	case string:
+		env := envVarName(typedRaw)
+		if !envNamePattern.MatchString(env) {
+			return ConfigValue{}, &ConfigError{Path: path, Message: fmt.Sprintf("%q does not name an environment variable, as %s is not a valid variable name", typedRaw, env)}
+		}
+		return ConfigValue{Kind: ConfigKindEnv, Env: env}, nil
+	case []interface{}:
+		value = ConfigValue{Kind: ConfigKindArray, Items: []ConfigValue{}}
+		for idx, rawItem := range typedRaw {
+			item, err := parseConfigValue(rawItem, indexPath(path, idx))
+			if err != nil {
+				return ConfigValue{}, err
+			}
+			value.Items = append(value.Items, item)
+		}
+		return value, nil
+	case map[string]interface{}:
+		return parseConfigMap(typedRaw, path)
+	default:
+		return ConfigValue{Kind: ConfigKindLiteral, Literal: raw}, nil
+	}
+}
+
+func parseConfigMap(rawMap map[string]interface{}, path string) (value ConfigValue, err error) {
+	switch {
+	case hasOnlyKeys(rawMap, "env", "default"):
+		env, ok := rawMap["env"].(string)
+		if !ok || env == "" {
+			return ConfigValue{}, &ConfigError{Path: path, Message: "env must name an environment variable"}
+		}
+		if !envNamePattern.MatchString(env) {
+			return ConfigValue{}, &ConfigError{Path: path, Message: fmt.Sprintf("env %q is not a valid environment variable name, which may only contain letters, digits and _ and not start with a digit", env)}
+		}
+		value = ConfigValue{Kind: ConfigKindEnv, Env: env}
+		value.Default, value.HasDefault = rawMap["default"]
+		return value, nil
+	case hasOnlyKeys(rawMap, "value"):
+		return ConfigValue{Kind: ConfigKindLiteral, Literal: rawMap["value"]}, nil
+	case hasOnlyKeys(rawMap, "secret"):
+		secret, _ := rawMap["secret"].(string)
+		parts := strings.SplitN(secret, "/", 2)
+		if len(parts) == 1 {
+			parts = append(parts, parts[0])
+		}
+		if parts[0] == "" || parts[1] == "" {
+			return ConfigValue{}, &ConfigError{Path: path, Message: fmt.Sprintf("secret %q must be of the form name/key", secret)}
+		}
+		return ConfigValue{Kind: ConfigKindSecret, SecretName: parts[0], SecretKey: parts[1]}, nil
+	case rawMap["env"] != nil:
+		// an env value with a misspelled default would otherwise become an object
+		for _, key := range sortedConfigKeys(rawMap) {
+			if key != "env" && key != "default" {
+				return ConfigValue{}, &ConfigError{Path: path, Message: fmt.Sprintf("unknown key %q next to env, which only takes default", key)}
+			}
+		}
+	}
+
+	fields, err := parseConfigFields(rawMap, path)
+	if err != nil {
+		return ConfigValue{}, err
+	}
+
+	return ConfigValue{Kind: ConfigKindObject, Fields: fields}, nil
+}
+
+// EnvName is the environment variable a value is read from at runtime, or
+// "" for values that are known at build time. Secrets are exposed to the
+// stage as environment variables named after the secret and key.
+func (v ConfigValue) EnvName() string {
+	switch v.Kind {
+	case ConfigKindEnv:
+		return v.Env
+	case ConfigKindSecret:
+		return strings.ToUpper(envNameUnsafe.ReplaceAllString(v.SecretName+"_"+v.SecretKey, "_"))
+	default:
+		return ""
+	}
+}
+
+// Describe summarizes a value for people, e.g. in graph labels.
+func (v ConfigValue) Describe() string {
+	switch v.Kind {
+	case ConfigKindEnv:
+		return "$" + v.Env
+	case ConfigKindSecret:
+		return fmt.Sprintf("secret %s/%s", v.SecretName, v.SecretKey)
+	case ConfigKindLiteral:
+		return fmt.Sprint(v.Literal)
+	default:
+		return v.Kind
+	}
+}
+
+func sortedConfigValueKeys(fields map[string]ConfigValue) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// JavaScript renders the value as a JavaScript expression.
+func (v ConfigValue) JavaScript() string {
+	switch v.Kind {
+	case ConfigKindEnv, ConfigKindSecret:
+		lookup := fmt.Sprintf("process.env.%s", v.EnvName())
+		if !v.HasDefault {
+			return lookup
+		}
+		return fmt.Sprintf("(%s !== undefined ? %s : %s)", lookup, lookup, jsonLiteral(v.Default))
+	case ConfigKindObject:
+		return javaScriptObject(v.Fields)
+	case ConfigKindArray:
+		items := []string{}
+		for _, item := range v.Items {
+			items = append(items, item.JavaScript())
+		}
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	default:
+		return jsonLiteral(v.Literal)
+	}
+}
+
+// Python renders the value as a Python expression.
+func (v ConfigValue) Python() string {
+	switch v.Kind {
+	case ConfigKindEnv, ConfigKindSecret:
+		if !v.HasDefault {
+			return fmt.Sprintf("os.environ[%s]", jsonLiteral(v.EnvName()))
+		}
+		return fmt.Sprintf("os.environ.get(%s, %s)", jsonLiteral(v.EnvName()), pythonLiteral(v.Default))
+	case ConfigKindObject:
+		return pythonDict(v.Fields)
+	case ConfigKindArray:
+		items := []string{}
+		for _, item := range v.Items {
+			items = append(items, item.Python())
+		}
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	default:
+		return pythonLiteral(v.Literal)
+	}
+}
+
+func pythonDict(fields map[string]ConfigValue) string {
+	entries := []string{}
+	for _, key := range sortedConfigValueKeys(fields) {
+		entries = append(entries, fmt.Sprintf(`%s: %s`, jsonLiteral(key), fields[key].Python()))
+	}
+
+	return fmt.Sprintf(`{%s}`, strings.Join(entries, ", "))
+}
+
+// pythonLiteral renders a JSON value as a Python literal. Strings and numbers
+// are written the same way in both.
+func pythonLiteral(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if typed {
+			return "True"
+		}
+		return "False"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		entries := []string{}
+		for _, key := range keys {
+			entries = append(entries, fmt.Sprintf(`%s: %s`, jsonLiteral(key), pythonLiteral(typed[key])))
+		}
+		return fmt.Sprintf(`{%s}`, strings.Join(entries, ", "))
+	case []interface{}:
+		items := []string{}
+		for _, item := range typed {
+			items = append(items, pythonLiteral(item))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	default:
+		return jsonLiteral(value)
+	}
+}
+
+// Go renders the value as a Go expression of type interface{}, reading the
+// environment with the envOr helper of the generated main.go.
+func (v ConfigValue) Go() string {
+	switch v.Kind {
+	case ConfigKindEnv, ConfigKindSecret:
+		if !v.HasDefault {
+			return fmt.Sprintf("os.Getenv(%s)", jsonLiteral(v.EnvName()))
+		}
+		return fmt.Sprintf("envOr(%s, %s)", jsonLiteral(v.EnvName()), goLiteral(v.Default))
+	case ConfigKindObject:
+		return goMap(v.Fields)
+	case ConfigKindArray:
+		items := []string{}
+		for _, item := range v.Items {
+			items = append(items, item.Go())
+		}
+		return fmt.Sprintf("[]interface{}{%s}", strings.Join(items, ", "))
+	default:
+		return goLiteral(v.Literal)
+	}
+}
+
+func goMap(fields map[string]ConfigValue) string {
+	entries := []string{}
+	for _, key := range sortedConfigValueKeys(fields) {
+		entries = append(entries, fmt.Sprintf(`%s: %s`, jsonLiteral(key), fields[key].Go()))
+	}
+
+	return fmt.Sprintf(`map[string]interface{}{%s}`, strings.Join(entries, ", "))
+}
+
+// goLiteral renders a JSON value as a Go literal.
+func goLiteral(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "nil"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		entries := []string{}
+		for _, key := range keys {
+			entries = append(entries, fmt.Sprintf(`%s: %s`, jsonLiteral(key), goLiteral(typed[key])))
+		}
+		return fmt.Sprintf(`map[string]interface{}{%s}`, strings.Join(entries, ", "))
+	case []interface{}:
+		items := []string{}
+		for _, item := range typed {
+			items = append(items, goLiteral(item))
+		}
+		return fmt.Sprintf("[]interface{}{%s}", strings.Join(items, ", "))
+	default:
+		return jsonLiteral(value)
+	}
+}
+
+var typeScriptIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// TypeScriptType is the type of the value once the stage has read it.
+// Environment variables are strings unless their default is of another type.
+func (v ConfigValue) TypeScriptType() string {
+	switch v.Kind {
+	case ConfigKindEnv, ConfigKindSecret:
+		if !v.HasDefault {
+			return "string"
+		}
+		return typeScriptUnion([]string{"string", typeScriptLiteralType(v.Default)})
+	case ConfigKindObject:
+		return typeScriptObjectType(v.Fields, "")
+	case ConfigKindArray:
+		itemTypes := []string{}
+		for _, item := range v.Items {
+			itemTypes = append(itemTypes, item.TypeScriptType())
+		}
+		if len(itemTypes) == 0 {
+			return "unknown[]"
+		}
+		return fmt.Sprintf("(%s)[]", typeScriptUnion(itemTypes))
+	default:
+		return typeScriptLiteralType(v.Literal)
+	}
+}
+
+// typeScriptObjectType renders the fields of a config as an object type,
+// one member per line after indent, or inline when indent is "".
+func typeScriptObjectType(fields map[string]ConfigValue, indent string) string {
+	members := []string{}
+	for _, key := range sortedConfigValueKeys(fields) {
+		name := key
+		if !typeScriptIdentifier.MatchString(key) {
+			name = jsonLiteral(key)
+		}
+		members = append(members, fmt.Sprintf("%s: %s;", name, fields[key].TypeScriptType()))
+	}
+
+	if len(members) == 0 {
+		return "{}"
+	}
+
+	if indent == "" {
+		return fmt.Sprintf("{ %s }", strings.Join(members, " "))
+	}
+
+	return fmt.Sprintf("{\n%s%s\n}", indent, strings.Join(members, "\n"+indent))
+}
+
+func typeScriptLiteralType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "unknown[]"
+	case map[string]interface{}:
+		return "Record<string, unknown>"
+	default:
+		return "number"
+	}
+}
+
+// typeScriptUnion joins distinct types, in the order they first appear.
+func typeScriptUnion(types []string) string {
+	seen := map[string]bool{}
+	union := []string{}
+	for _, typeName := range types {
+		if !seen[typeName] {
+			seen[typeName] = true
+			union = append(union, typeName)
+		}
+	}
+
+	return strings.Join(union, " | ")
+}
+
+func javaScriptObject(fields map[string]ConfigValue) string {
+	entries := []string{}
+	for _, key := range sortedConfigValueKeys(fields) {
+		entries = append(entries, fmt.Sprintf(`%s: %s`, jsonLiteral(key), fields[key].JavaScript()))
+	}
+
+	return fmt.Sprintf(`{%s}`, strings.Join(entries, ", "))
+}
+
+func jsonLiteral(value interface{}) string {
+	literal, err := json.Marshal(value)
+	if err != nil {
+		return "null"
+	}
+
+	return string(literal)
+}
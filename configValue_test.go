@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const typedConfigJSON = `{
+    "endpoint": "kafka-endpoint",
+    "brokers": {"env": "KAFKA_BROKERS", "default": "localhost:9092"},
+    "topic": {"value": "locations"},
+    "batchSize": {"value": 500},
+    "compress": true,
+    "password": {"secret": "cassandra/password"},
+    "retry": {
+        "attempts": {"value": 3},
+        "backoff": [{"value": 100}, "backoff-max"]
+    },
+    "schema": {"value": {"type": "record", "fields": []}}
+}`
+
+const expectedTypedConfigJavaScript = `{"batchSize": 500, "brokers": (process.env.KAFKA_BROKERS !== undefined ? process.env.KAFKA_BROKERS : "localhost:9092"), "compress": true, "endpoint": process.env.KAFKA_ENDPOINT, "password": process.env.CASSANDRA_PASSWORD, "retry": {"attempts": 3, "backoff": [100, process.env.BACKOFF_MAX]}, "schema": {"fields":[],"type":"record"}, "topic": "locations"}`
+
+func TestBuildTypedConfig(t *testing.T) {
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(typedConfigJSON), &config)
+	if err != nil {
+		t.Errorf("could not unmarshal config: %s", err)
+	}
+
+	nodeJsBuilder := NodeJsPlatformBuilder{}
+	configJavaScript := nodeJsBuilder.buildConfig(config)
+	if configJavaScript != expectedTypedConfigJavaScript {
+		t.Errorf("config did not match:-->%s<-- vs. -->%s<--", configJavaScript, expectedTypedConfigJavaScript)
+	}
+}
+
+const expectedTypedConfigPython = `{"batchSize": 500, "brokers": os.environ.get("KAFKA_BROKERS", "localhost:9092"), "compress": True, "endpoint": os.environ["KAFKA_ENDPOINT"], "password": os.environ["CASSANDRA_PASSWORD"], "retry": {"attempts": 3, "backoff": [100, os.environ["BACKOFF_MAX"]]}, "schema": {"fields": [], "type": "record"}, "topic": "locations"}`
+
+func TestBuildTypedConfigPython(t *testing.T) {
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(typedConfigJSON), &config)
+	if err != nil {
+		t.Errorf("could not unmarshal config: %s", err)
+	}
+
+	pythonBuilder := PythonPlatformBuilder{}
+	configPython := pythonBuilder.buildConfig(config)
+	if configPython != expectedTypedConfigPython {
+		t.Errorf("config did not match:-->%s<-- vs. -->%s<--", configPython, expectedTypedConfigPython)
+	}
+}
+
+const expectedTypedConfigGo = `map[string]interface{}{"batchSize": 500, "brokers": envOr("KAFKA_BROKERS", "localhost:9092"), "compress": true, "endpoint": os.Getenv("KAFKA_ENDPOINT"), "password": os.Getenv("CASSANDRA_PASSWORD"), "retry": map[string]interface{}{"attempts": 3, "backoff": []interface{}{100, os.Getenv("BACKOFF_MAX")}}, "schema": map[string]interface{}{"fields": []interface{}{}, "type": "record"}, "topic": "locations"}`
+
+func TestBuildTypedConfigGo(t *testing.T) {
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(typedConfigJSON), &config)
+	if err != nil {
+		t.Errorf("could not unmarshal config: %s", err)
+	}
+
+	goBuilder := GoPlatformBuilder{}
+	configGo := goBuilder.buildConfig(config)
+	if configGo != expectedTypedConfigGo {
+		t.Errorf("config did not match:-->%s<-- vs. -->%s<--", configGo, expectedTypedConfigGo)
+	}
+}
+
+const expectedTypedConfigTypeScript = `{
+    batchSize: number;
+    brokers: string;
+    compress: boolean;
+    endpoint: string;
+    password: string;
+    retry: { attempts: number; backoff: (number | string)[]; };
+    schema: Record<string, unknown>;
+    topic: string;
+}`
+
+func TestTypedConfigTypeScriptType(t *testing.T) {
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(typedConfigJSON), &config)
+	if err != nil {
+		t.Errorf("could not unmarshal config: %s", err)
+	}
+
+	values, err := ParseConfig(config)
+	if err != nil {
+		t.Errorf("could not parse config: %s", err)
+	}
+
+	configType := typeScriptObjectType(values, "    ")
+	if configType != expectedTypedConfigTypeScript {
+		t.Errorf("config type did not match:-->%s<-- vs. -->%s<--", configType, expectedTypedConfigTypeScript)
+	}
+}
+
+func TestParseConfigValue(t *testing.T) {
+	value, err := ParseConfigValue(map[string]interface{}{"secret": "cassandra/password"})
+	if err != nil || value.Kind != ConfigKindSecret || value.SecretName != "cassandra" || value.SecretKey != "password" {
+		t.Errorf("secret was not parsed correctly: %+v %s", value, err)
+	}
+
+	if value.EnvName() != "CASSANDRA_PASSWORD" {
+		t.Errorf("secret env name was not derived correctly: %s", value.EnvName())
+	}
+
+	value, err = ParseConfigValue("estimated-arrivals-topic")
+	if err != nil || value.Kind != ConfigKindEnv || value.EnvName() != "ESTIMATED_ARRIVALS_TOPIC" {
+		t.Errorf("shorthand was not parsed correctly: %+v %s", value, err)
+	}
+
+	invalidValues := map[string]interface{}{
+		"kafka.endpoint":  "kafka.endpoint",
+		"env with dash":   map[string]interface{}{"env": "kafka-endpoint"},
+		"env with digit":  map[string]interface{}{"env": "9LIVES"},
+		"misspelled keys": map[string]interface{}{"env": "KAFKA_ENDPOINT", "defualt": 1},
+	}
+	for name, raw := range invalidValues {
+		if _, err := ParseConfigValue(raw); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+
+	_, err = ParseConfig(map[string]interface{}{
+		"retry": map[string]interface{}{
+			"backoff": []interface{}{map[string]interface{}{"secret": ""}},
+		},
+	})
+	configErr, ok := err.(*ConfigError)
+	if !ok || configErr.Path != "retry.backoff[0]" {
+		t.Errorf("invalid nested value was not reported with its path: %s", err)
+	}
+}
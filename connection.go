@@ -1,7 +1,8 @@
 package main
 
 type Connection struct {
-	Platform     string
-	Dependencies map[string]string
-	Config       map[string]interface{}
+	Platform     string                 `json:"platform,omitempty"`
+	Dependencies map[string]string      `json:"dependencies,omitempty"`
+	Config       map[string]interface{} `json:"config,omitempty"`
+	Partitions   int32                  `json:"partitions,omitempty"`
 }
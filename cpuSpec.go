@@ -1,6 +1,6 @@
 package main
 
 type CPUSpec struct {
-	Request string
-	Limit   string
+	Request string `json:"request,omitempty"`
+	Limit   string `json:"limit,omitempty"`
 }
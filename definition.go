@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// definitionFormat picks the decoder for a definition file from its
+// extension. Anything that isn't YAML is read as JSON.
+func definitionFormat(definitionPath string) string {
+	switch strings.ToLower(filepath.Ext(definitionPath)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	default:
+		return formatJSON
+	}
+}
+
+// readDefinition reads a JSON or YAML definition file into a generic
+// document of maps, slices and scalars, along with a source map of where
+// each value came from.
+func readDefinition(definitionPath string) (document interface{}, source *SourceMap, diagnostics Diagnostics) {
+	source = NewSourceMap(definitionPath)
+
+	contents, err := ioutil.ReadFile(definitionPath)
+	if err != nil {
+		diagnostics.Errorf(CodeIOError, source, "", "%s", err)
+		return nil, source, diagnostics
+	}
+
+	switch definitionFormat(definitionPath) {
+	case formatYAML:
+		document, err = parseYAMLDefinition(contents, source)
+		if err != nil {
+			diagnostics = append(diagnostics, yamlDiagnostic(source, err))
+			return nil, source, diagnostics
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.UseNumber()
+
+		err = decoder.Decode(&document)
+		if err != nil {
+			diagnostics = append(diagnostics, decodeDiagnostic(source, contents, err))
+			return nil, source, diagnostics
+		}
+
+		source.IndexJSON(contents)
+	}
+
+	return document, source, diagnostics
+}
+
+// decodeDefinition decodes a generic document into the typed model. Going
+// through JSON keeps field matching identical whatever the file format was.
+func decodeDefinition(document interface{}, source *SourceMap, target interface{}) (diagnostics Diagnostics) {
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		diagnostics.Errorf(CodeParseError, source, "", "%s", err)
+		return diagnostics
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(documentJSON))
+	decoder.UseNumber()
+
+	err = decoder.Decode(target)
+	if err != nil {
+		diagnostic := decodeDiagnostic(source, nil, err)
+		position := source.LocatePosition(diagnostic.Path)
+		diagnostic.File, diagnostic.Line, diagnostic.Column = position.File, position.Line, position.Column
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
+
+func parseYAMLDefinition(contents []byte, source *SourceMap) (document interface{}, err error) {
+	var root yaml.Node
+	err = yaml.Unmarshal(contents, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(root.Content) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	source.IndexYAML(root.Content[0], "")
+
+	err = root.Content[0].Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// IndexYAML records the position of every mapping key and sequence item
+// beneath node.
+func (s *SourceMap) IndexYAML(node *yaml.Node, path string) {
+	s.setIfAbsent(path, Position{Line: node.Line, Column: node.Column})
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			keyNode := node.Content[idx]
+			memberPath := joinPath(path, keyNode.Value)
+			s.Set(memberPath, Position{Line: keyNode.Line, Column: keyNode.Column})
+			s.IndexYAML(node.Content[idx+1], memberPath)
+		}
+	case yaml.SequenceNode:
+		for idx, itemNode := range node.Content {
+			s.IndexYAML(itemNode, indexPath(path, idx))
+		}
+	case yaml.AliasNode:
+		s.IndexYAML(node.Alias, path)
+	}
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+var yamlErrorPrefix = regexp.MustCompile(`^yaml: (line \d+: )?`)
+
+func yamlDiagnostic(source *SourceMap, err error) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeParseError,
+		File:     source.File,
+		Message:  yamlErrorPrefix.ReplaceAllString(err.Error(), ""),
+	}
+
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		diagnostic.Line, _ = strconv.Atoi(match[1])
+		diagnostic.Column = 1
+	}
+
+	return diagnostic
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadYAMLMatchesJSON(t *testing.T) {
+	jsonBuilder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := jsonBuilder.Load()
+	if err != nil {
+		t.Errorf("JSON builder failed to load: %s", err)
+	}
+
+	yamlBuilder := NewBuilder("fixtures/topology.yaml", "fixtures/environment.yaml")
+	err = yamlBuilder.Load()
+	if err != nil {
+		t.Errorf("YAML builder failed to load: %s", err)
+	}
+
+	if !reflect.DeepEqual(jsonBuilder.Topology, yamlBuilder.Topology) {
+		t.Errorf("YAML topology did not match JSON:-->%v<-- vs. -->%v<--", yamlBuilder.Topology, jsonBuilder.Topology)
+	}
+
+	if !reflect.DeepEqual(jsonBuilder.Environment, yamlBuilder.Environment) {
+		t.Errorf("YAML environment did not match JSON:-->%v<-- vs. -->%v<--", yamlBuilder.Environment, jsonBuilder.Environment)
+	}
+}
+
+func TestYAMLDiagnosticPositions(t *testing.T) {
+	builder := NewBuilder("fixtures/invalid-topology.json", "fixtures/environment.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	line, column := builder.EnvironmentSource.Locate("deployments.predict-arrivals.nodes[0]")
+	if line != 45 || column != 13 {
+		t.Errorf("predict-arrivals nodes[0] located at %d:%d", line, column)
+	}
+
+	directory, err := ioutil.TempDir("", "topo")
+	if err != nil {
+		t.Errorf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(directory)
+
+	environmentPath := path.Join(directory, "environment.yml")
+	ioutil.WriteFile(environmentPath, []byte("tier: production\ndeployments:\n  write-locations:\n    replicas:\n      min: one\n"), 0644)
+
+	builder = NewBuilder("fixtures/topology.json", environmentPath)
+	err = builder.Load()
+	if err == nil {
+		t.Errorf("Load should fail on a mistyped YAML value")
+	}
+
+	diagnostic := builder.Diagnostics[0]
+	if diagnostic.Path != "deployments.write-locations.replicas.min" || diagnostic.Line != 5 || diagnostic.Column != 7 {
+		t.Errorf("YAML type error was not positioned: %s", diagnostic)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyRequest is the version range of a package that one node's
+// processor or one connection asks for.
+type DependencyRequest struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Range string `json:"range"`
+}
+
+func (r DependencyRequest) String() string {
+	return fmt.Sprintf("%s %s wants %s", r.Kind, r.ID, r.Range)
+}
+
+// ResolvedDependency is a package with the range that satisfies every
+// request for it, or Conflict when no version does.
+type ResolvedDependency struct {
+	Name        string              `json:"name"`
+	Range       string              `json:"range,omitempty"`
+	Conflict    bool                `json:"conflict,omitempty"`
+	RequestedBy []DependencyRequest `json:"requestedBy"`
+}
+
+// ConflictMessage names every requester of a conflicting package and the
+// range it asks for.
+func (d ResolvedDependency) ConflictMessage() string {
+	requests := []string{}
+	for _, request := range d.RequestedBy {
+		requests = append(requests, request.String())
+	}
+
+	return fmt.Sprintf("conflicting versions of %s: %s", d.Name, strings.Join(requests, ", "))
+}
+
+// collectDependencies gathers, per package, the ranges asked for by the
+// processors of a set of nodes and by the connections those nodes use, the
+// connections first and then the nodes, each sorted by id.
+func collectDependencies(nodeIds []string, topology Topology, environment Environment) map[string][]DependencyRequest {
+	requests := map[string][]DependencyRequest{}
+
+	nodes := map[string]bool{}
+	for _, nodeId := range nodeIds {
+		nodes[nodeId] = true
+	}
+	nodeIds = sortedKeys(nodes)
+
+	for _, connectionId := range deploymentConnections(Deployment{Nodes: nodeIds}, topology) {
+		for packageName, version := range environment.Connections[connectionId].Dependencies {
+			requests[packageName] = append(requests[packageName], DependencyRequest{Kind: "connection", ID: connectionId, Range: version})
+		}
+	}
+
+	for _, nodeId := range nodeIds {
+		for packageName, version := range topology.Nodes[nodeId].Processor.Dependencies {
+			requests[packageName] = append(requests[packageName], DependencyRequest{Kind: "node", ID: nodeId, Range: version})
+		}
+	}
+
+	return requests
+}
+
+// resolveDependency intersects the ranges requested for a package. Of the
+// ranges that equal the intersection the first requested is kept as it was
+// written, otherwise the intersection itself is used. Ranges that are not
+// semver, such as tags or git urls, only agree with the very same range.
+func resolveDependency(name string, requests []DependencyRequest) (resolved ResolvedDependency) {
+	resolved = ResolvedDependency{Name: name, RequestedBy: requests}
+
+	var intersection SemVerRange
+	opaque := false
+	for idx, request := range requests {
+		semVerRange, err := ParseSemVerRange(request.Range)
+		if err != nil {
+			opaque = true
+		}
+
+		switch {
+		case idx == 0:
+			intersection = semVerRange
+		case opaque:
+			if request.Range != requests[0].Range {
+				resolved.Conflict = true
+				return resolved
+			}
+		default:
+			intersection = intersection.Intersect(semVerRange)
+		}
+
+		if len(intersection) == 0 && !opaque {
+			resolved.Conflict = true
+			return resolved
+		}
+	}
+
+	if opaque {
+		resolved.Range = requests[0].Range
+		return resolved
+	}
+
+	resolved.Range = intersection.String()
+	for _, request := range requests {
+		if semVerRange, _ := ParseSemVerRange(request.Range); semVerRange.String() == resolved.Range {
+			resolved.Range = request.Range
+			break
+		}
+	}
+
+	return resolved
+}
+
+// resolveDependencies resolves every collected package, sorted by name.
+func resolveDependencies(requests map[string][]DependencyRequest) (resolved []ResolvedDependency) {
+	packageNames := make([]string, 0, len(requests))
+	for packageName := range requests {
+		packageNames = append(packageNames, packageName)
+	}
+	sort.Strings(packageNames)
+
+	for _, packageName := range packageNames {
+		resolved = append(resolved, resolveDependency(packageName, requests[packageName]))
+	}
+
+	return resolved
+}
+
+// dependencyVersions maps every resolved package to its range. Conflicting
+// packages, which the Validate of each platform reports, keep the range of
+// their last requester.
+func dependencyVersions(resolved []ResolvedDependency) (dependencies map[string]string) {
+	dependencies = map[string]string{}
+	for _, dependency := range resolved {
+		if dependency.Conflict {
+			dependencies[dependency.Name] = dependency.RequestedBy[len(dependency.RequestedBy)-1].Range
+		} else {
+			dependencies[dependency.Name] = dependency.Range
+		}
+	}
+
+	return dependencies
+}
+
+// dependencyConflicts reports each conflicting package at the dependency
+// of its first requester.
+func dependencyConflicts(resolved []ResolvedDependency, topologySource *SourceMap, environmentSource *SourceMap) (diagnostics Diagnostics) {
+	for _, dependency := range resolved {
+		if !dependency.Conflict {
+			continue
+		}
+
+		request := dependency.RequestedBy[0]
+		if request.Kind == "connection" {
+			diagnostics.Errorf(CodeDependencyConflict, environmentSource, joinPath(joinPath(joinPath("connections", request.ID), "dependencies"), dependency.Name), "%s", dependency.ConflictMessage())
+		} else {
+			diagnostics.Errorf(CodeDependencyConflict, topologySource, joinPath(joinPath(joinPath("nodes", request.ID), "processor.dependencies"), dependency.Name), "%s", dependency.ConflictMessage())
+		}
+	}
+
+	return diagnostics
+}
+
+// ResolveDependencies resolves the npm dependencies of the whole topology,
+// across the processors of every node.js deployment and the connections
+// they use, and reports the packages they disagree on.
+func (b *Builder) ResolveDependencies() (resolved []ResolvedDependency, diagnostics Diagnostics) {
+	nodeIds := []string{}
+	for _, deploymentID := range sortedDeploymentIds(b.Environment.Deployments) {
+		if platform, err := b.DeploymentPlatform(deploymentID); err == nil && platform == nodeJsPlatform {
+			nodeIds = append(nodeIds, b.Environment.Deployments[deploymentID].Nodes...)
+		}
+	}
+
+	resolved = resolveDependencies(collectDependencies(nodeIds, b.Topology, b.Environment))
+	return resolved, dependencyConflicts(resolved, b.TopologySource, b.EnvironmentSource)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestResolveDependency(t *testing.T) {
+	resolutions := []struct {
+		ranges   []string
+		expected string
+	}{
+		{[]string{"^3.3.0", "^3.3.0"}, "^3.3.0"},
+		{[]string{"^3.3.0", "~3.4.1"}, "~3.4.1"},
+		{[]string{"^3.3.0", ">=3.5.0", "<3.9"}, ">=3.5.0 <3.9.0"},
+		{[]string{"1.x", "^1.2.0", "*"}, "^1.2.0"},
+		{[]string{"latest", "latest"}, "latest"},
+	}
+
+	for _, resolution := range resolutions {
+		requests := []DependencyRequest{}
+		for idx, version := range resolution.ranges {
+			requests = append(requests, DependencyRequest{Kind: "node", ID: fmt.Sprintf("node%d", idx), Range: version})
+		}
+
+		resolved := resolveDependency("cassandra-driver", requests)
+		if resolved.Conflict || resolved.Range != resolution.expected {
+			t.Errorf("resolution of %s did not match:-->%s<-- vs. -->%s<--", strings.Join(resolution.ranges, ", "), resolved.Range, resolution.expected)
+		}
+	}
+
+	for _, ranges := range [][]string{{"^3.3.0", "^4.0.0"}, {"latest", "^4.0.0"}, {"^4.0.0", "next"}} {
+		requests := []DependencyRequest{}
+		for idx, version := range ranges {
+			requests = append(requests, DependencyRequest{Kind: "node", ID: fmt.Sprintf("node%d", idx), Range: version})
+		}
+
+		if resolved := resolveDependency("cassandra-driver", requests); !resolved.Conflict {
+			t.Errorf("expected %s to conflict, resolved to %s", strings.Join(ranges, ", "), resolved.Range)
+		}
+	}
+}
+
+func TestNodeJsDependencies(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	connection := builder.Environment.Connections["locations"]
+	connection.Dependencies = map[string]string{"topological-kafka": "^1.0.4", "cassandra-driver": "~3.4.1"}
+	builder.Environment.Connections["locations"] = connection
+
+	platformBuilder, err := builder.MakeBuilder("write-locations")
+	if err != nil {
+		t.Fatalf("failed to make builder: %s", err)
+	}
+
+	if diagnostics := platformBuilder.Validate(); len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got: %v", diagnostics)
+	}
+
+	dependencies := platformBuilder.Dependencies()
+	if dependencies["cassandra-driver"] != "~3.4.1" {
+		t.Errorf("cassandra-driver did not match:-->%s<-- vs. -->%s<--", dependencies["cassandra-driver"], "~3.4.1")
+	}
+}
+
+func TestResolveDependenciesConflict(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	node := builder.Topology.Nodes["predictArrivals"]
+	node.Processor.Dependencies = map[string]string{"cassandra-driver": "^4.0.0"}
+	builder.Topology.Nodes["predictArrivals"] = node
+
+	resolved, diagnostics := builder.ResolveDependencies()
+	if len(resolved) != 2 || resolved[0].Name != "cassandra-driver" || !resolved[0].Conflict {
+		t.Fatalf("expected cassandra-driver to conflict, got: %v", resolved)
+	}
+	if resolved[1].Name != "topological-kafka" || resolved[1].Range != "^1.0.4" {
+		t.Errorf("expected topological-kafka to resolve to ^1.0.4, got: %v", resolved[1])
+	}
+
+	expectedDiagnostics := "fixtures/topology.json:17:13 nodes.predictArrivals.processor.dependencies.cassandra-driver: conflicting versions of cassandra-driver: node predictArrivals wants ^4.0.0, node writeLocations wants ^3.3.0"
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeDependencyConflict) || diagnostics[0].String() != expectedDiagnostics {
+		t.Errorf("diagnostics did not match:-->%v<-- vs. -->%s<--", diagnostics, expectedDiagnostics)
+	}
+
+	// each deployment resolves only its own processors and connections
+	platformBuilder, err := builder.MakeBuilder("write-locations")
+	if err != nil {
+		t.Fatalf("failed to make builder: %s", err)
+	}
+
+	if diagnostics := platformBuilder.Validate(); len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics for write-locations, got: %v", diagnostics)
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 type Deployment struct {
-	Instances   uint32
-	Concurrency uint32
-	CPU         CPUSpec
-	LogSeverity string
-	Memory      MemorySpec
-	Nodes       []string
-	Replicas    ReplicaSpec
+	Instances   uint32      `json:"instances,omitempty"`
+	Concurrency uint32      `json:"concurrency,omitempty"`
+	CPU         CPUSpec     `json:"cpu"`
+	LogSeverity string      `json:"logSeverity,omitempty"`
+	Memory      MemorySpec  `json:"memory"`
+	Nodes       []string    `json:"nodes"`
+	Replicas    ReplicaSpec `json:"replicas"`
+	Target      string      `json:"target,omitempty"`
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return "error"
+	}
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Diagnostic codes, grouped by the stage that reports them.
+const (
+	CodeIOError            = "io-error"
+	CodeParseError         = "parse-error"
+	CodeUnknownTarget      = "unknown-target"
+	CodeUnknownConnection  = "unknown-connection"
+	CodeUnknownNode        = "unknown-node"
+	CodeMismatchedPlatform = "mismatched-platform"
+	CodeUndeployedNode     = "undeployed-node"
+	CodeDuplicateNode      = "duplicate-node"
+	CodeUnknownProcessor   = "unknown-processor"
+	CodeMissingProcessor   = "missing-processor-file"
+	CodeMissingImport      = "missing-import"
+	CodeDependencyConflict = "dependency-conflict"
+	CodeInvalidDependency  = "invalid-dependency"
+	CodeUnknownPlatform    = "unknown-platform"
+	CodeInvalidProcessor   = "invalid-processor"
+	CodePluginError        = "plugin-error"
+	CodeBuildError         = "build-error"
+	CodeInvalidReplicas    = "invalid-replicas"
+	CodeExceedsPartitions  = "exceeds-partitions"
+
+	CodeCycle               = "cycle"
+	CodeUnreadConnection    = "unread-connection"
+	CodeUnwrittenConnection = "unwritten-connection"
+	CodeUnreachableNode     = "unreachable-node"
+
+	CodeUndefinedVariable = "undefined-variable"
+	CodeInvalidVariable   = "invalid-variable"
+
+	CodeInvalidConfig       = "invalid-config"
+	CodeConflictingDefaults = "conflicting-defaults"
+
+	CodeMismatchedEnvironments = "mismatched-environments"
+)
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// String renders the diagnostic as file:line:column path: message, leaving
+// out whichever parts of the location are unknown.
+func (d Diagnostic) String() string {
+	location := d.File
+	if location != "" && d.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", location, d.Line, d.Column)
+	}
+
+	if d.Path != "" {
+		if location != "" {
+			location += " "
+		}
+		location += d.Path
+	}
+
+	if location == "" {
+		return d.Message
+	}
+
+	return fmt.Sprintf("%s: %s", location, d.Message)
+}
+
+type Diagnostics []Diagnostic
+
+func (ds *Diagnostics) Add(severity Severity, code string, source *SourceMap, path string, message string) {
+	diagnostic := Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Path:     path,
+		Message:  message,
+	}
+
+	if source != nil {
+		position := source.LocatePosition(path)
+		diagnostic.File, diagnostic.Line, diagnostic.Column = position.File, position.Line, position.Column
+	}
+
+	*ds = append(*ds, diagnostic)
+}
+
+func (ds *Diagnostics) Errorf(code string, source *SourceMap, path string, format string, args ...interface{}) {
+	ds.Add(SeverityError, code, source, path, fmt.Sprintf(format, args...))
+}
+
+func (ds *Diagnostics) Warnf(code string, source *SourceMap, path string, format string, args ...interface{}) {
+	ds.Add(SeverityWarning, code, source, path, fmt.Sprintf(format, args...))
+}
+
+func (ds *Diagnostics) Infof(code string, source *SourceMap, path string, format string, args ...interface{}) {
+	ds.Add(SeverityInfo, code, source, path, fmt.Sprintf(format, args...))
+}
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, diagnostic := range ds {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ds Diagnostics) HasWarnings() bool {
+	for _, diagnostic := range ds {
+		if diagnostic.Severity == SeverityWarning {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ds Diagnostics) HasCode(code string) bool {
+	for _, diagnostic := range ds {
+		if diagnostic.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Error lets a set of diagnostics be returned wherever an error is expected.
+func (ds Diagnostics) Error() string {
+	messages := []string{}
+	for _, diagnostic := range ds {
+		if diagnostic.Severity == SeverityError {
+			messages = append(messages, diagnostic.String())
+		}
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// errorDiagnostics turns an error that stopped a command into diagnostics.
+// Diagnostics are kept as they are, file system errors become io-error and
+// anything else a build-error.
+func errorDiagnostics(err error) (diagnostics Diagnostics) {
+	switch err := err.(type) {
+	case Diagnostics:
+		return err
+	case *os.PathError, *os.LinkError, *os.SyscallError:
+		diagnostics.Errorf(CodeIOError, nil, "", "%s", err)
+	default:
+		diagnostics.Errorf(CodeBuildError, nil, "", "%s", err)
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// EnvUsage is one config key that is read from an environment variable.
+type EnvUsage struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+}
+
+func (u EnvUsage) String() string {
+	return fmt.Sprintf("%s %s: %s", u.Kind, u.ID, u.Key)
+}
+
+// EnvRequirement is an environment variable that a deployment's generated
+// stage reads at runtime, and every config key that needs it.
+type EnvRequirement struct {
+	Name       string      `json:"name"`
+	SecretName string      `json:"secretName,omitempty"`
+	SecretKey  string      `json:"secretKey,omitempty"`
+	Default    interface{} `json:"default,omitempty"`
+	HasDefault bool        `json:"hasDefault,omitempty"`
+	UsedBy     []EnvUsage  `json:"usedBy"`
+
+	// defaultedBy is the first usage that gave a default, which Default
+	// then holds, and conflicts are the usages whose default differs from it.
+	defaultedBy *EnvUsage
+	conflicts   []envDefaultConflict
+}
+
+// envDefaultConflict is a usage whose default differs from the one an
+// earlier usage of the same variable gave.
+type envDefaultConflict struct {
+	Usage          EnvUsage
+	Default        interface{}
+	DefaultedBy    EnvUsage
+	EarlierDefault interface{}
+}
+
+// ConfigPath is the path of the config value of a usage in the environment.
+func (u EnvUsage) ConfigPath() string {
+	parent := "connections"
+	if u.Kind == "processor" {
+		parent = "processors"
+	}
+
+	return joinPath(joinPath(joinPath(parent, u.ID), "config"), u.Key)
+}
+
+func (r EnvRequirement) IsSecret() bool {
+	return r.SecretName != ""
+}
+
+// deploymentConnections returns the ids of every connection the nodes of a
+// deployment read from or write to.
+func deploymentConnections(deployment Deployment, topology Topology) []string {
+	connections := map[string]bool{}
+	for _, nodeId := range deployment.Nodes {
+		node := topology.Nodes[nodeId]
+		for _, connectionId := range node.Inputs {
+			connections[connectionId] = true
+		}
+		for _, connectionId := range node.Outputs {
+			connections[connectionId] = true
+		}
+	}
+
+	return sortedKeys(connections)
+}
+
+func collectConfigEnv(value ConfigValue, key string, usage EnvUsage, requirements map[string]*EnvRequirement) {
+	switch value.Kind {
+	case ConfigKindObject:
+		for _, field := range sortedConfigValueKeys(value.Fields) {
+			collectConfigEnv(value.Fields[field], joinPath(key, field), usage, requirements)
+		}
+	case ConfigKindArray:
+		for idx, item := range value.Items {
+			collectConfigEnv(item, indexPath(key, idx), usage, requirements)
+		}
+	case ConfigKindEnv, ConfigKindSecret:
+		name := value.EnvName()
+		requirement, ok := requirements[name]
+		if !ok {
+			requirement = &EnvRequirement{
+				Name:       name,
+				SecretName: value.SecretName,
+				SecretKey:  value.SecretKey,
+				HasDefault: true,
+			}
+			requirements[name] = requirement
+		}
+
+		usage.Key = key
+		requirement.UsedBy = append(requirement.UsedBy, usage)
+
+		// a variable is only optional if every usage of it has a default
+		requirement.HasDefault = requirement.HasDefault && value.HasDefault
+		if value.HasDefault {
+			if requirement.defaultedBy == nil {
+				defaultedBy := usage
+				requirement.Default, requirement.defaultedBy = value.Default, &defaultedBy
+			} else if !reflect.DeepEqual(requirement.Default, value.Default) {
+				requirement.conflicts = append(requirement.conflicts, envDefaultConflict{Usage: usage, Default: value.Default, DefaultedBy: *requirement.defaultedBy, EarlierDefault: requirement.Default})
+			}
+		}
+	}
+}
+
+// collectEnvRequirements lists, sorted by name, every environment variable
+// that the connections and processors of a deployment read their config from.
+func collectEnvRequirements(deployment Deployment, topology Topology, environment Environment) []EnvRequirement {
+	requirements := map[string]*EnvRequirement{}
+
+	for _, connectionId := range deploymentConnections(deployment, topology) {
+		values, _ := ParseConfig(environment.Connections[connectionId].Config)
+		for _, key := range sortedConfigValueKeys(values) {
+			collectConfigEnv(values[key], key, EnvUsage{Kind: "connection", ID: connectionId}, requirements)
+		}
+	}
+
+	nodeIds := append([]string{}, deployment.Nodes...)
+	sort.Strings(nodeIds)
+	for _, nodeId := range nodeIds {
+		values, _ := ParseConfig(environment.Processors[nodeId].Config)
+		for _, key := range sortedConfigValueKeys(values) {
+			collectConfigEnv(values[key], key, EnvUsage{Kind: "processor", ID: nodeId}, requirements)
+		}
+	}
+
+	names := make([]string, 0, len(requirements))
+	for name := range requirements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := []EnvRequirement{}
+	for _, name := range names {
+		requirement := *requirements[name]
+		if !requirement.HasDefault {
+			requirement.Default = nil
+		}
+		sorted = append(sorted, requirement)
+	}
+
+	return sorted
+}
+
+// FillEnvExample renders a .env.example listing every variable a deployment
+// needs, with the config keys that read it as comments.
+func FillEnvExample(deploymentID string, requirements []EnvRequirement) string {
+	return fillEnvExample(fmt.Sprintf("# environment variables read by deployment %s", deploymentID), requirements)
+}
+
+func fillEnvExample(header string, requirements []EnvRequirement) string {
+	lines := []string{header}
+
+	for _, requirement := range requirements {
+		lines = append(lines, "")
+		for _, usage := range requirement.UsedBy {
+			lines = append(lines, fmt.Sprintf("# %s", usage))
+		}
+		if requirement.IsSecret() {
+			lines = append(lines, fmt.Sprintf("# from key %s of secret %s", requirement.SecretKey, requirement.SecretName))
+		}
+		if requirement.HasDefault {
+			lines = append(lines, fmt.Sprintf("# optional, defaults to %s", jsonLiteral(requirement.Default)))
+		}
+		lines = append(lines, fmt.Sprintf("%s=", requirement.Name))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func fillSecretManifest(name string, namespace string, keys []string) string {
+	data := []string{}
+	for _, key := range keys {
+		data = append(data, fmt.Sprintf(`  %s: ""`, jsonLiteral(key)))
+	}
+
+	return fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+  namespace: %s
+type: Opaque
+stringData:
+%s
+`, jsonLiteral(name), jsonLiteral(namespace), strings.Join(data, "\n"))
+}
+
+// deploymentSecretName is the Secret holding the plain environment variables
+// of a deployment, as opposed to the secret-typed config values, which live
+// in the Secrets they name.
+func deploymentSecretName(deploymentID string) string {
+	return deploymentID + "-env"
+}
+
+// FillSecretSkeleton renders Kubernetes Secret manifests with empty values
+// for every variable a deployment needs: one Secret for the deployment's
+// plain variables and one for each Secret named by secret-typed config.
+func FillSecretSkeleton(deploymentID string, namespace string, requirements []EnvRequirement) string {
+	plainKeys := []string{}
+	secretKeys := map[string][]string{}
+	for _, requirement := range requirements {
+		if requirement.IsSecret() {
+			secretKeys[requirement.SecretName] = append(secretKeys[requirement.SecretName], requirement.SecretKey)
+		} else {
+			plainKeys = append(plainKeys, requirement.Name)
+		}
+	}
+
+	manifests := []string{}
+	if len(plainKeys) > 0 {
+		manifests = append(manifests, fillSecretManifest(deploymentSecretName(deploymentID), namespace, plainKeys))
+	}
+
+	secretNames := make([]string, 0, len(secretKeys))
+	for secretName := range secretKeys {
+		secretNames = append(secretNames, secretName)
+	}
+	sort.Strings(secretNames)
+
+	for _, secretName := range secretNames {
+		keys := secretKeys[secretName]
+		sort.Strings(keys)
+		manifests = append(manifests, fillSecretManifest(secretName, namespace, keys))
+	}
+
+	return strings.Join(manifests, "---\n")
+}
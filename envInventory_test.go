@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+)
+
+const expectedWriteLocationsEnvExample = `# environment variables read by deployment write-locations
+
+# processor writeLocations: cassandraEndpoints
+CASSANDRA_ENDPOINT=
+
+# connection locations: endpoint
+KAFKA_ENDPOINT=
+
+# connection locations: keyField
+LOCATIONS_KEYFIELD=
+
+# connection locations: topic
+LOCATIONS_TOPIC=
+`
+
+const expectedSecretSkeleton = `apiVersion: v1
+kind: Secret
+metadata:
+  name: "write-locations-env"
+  namespace: "data-pipeline"
+type: Opaque
+stringData:
+  "KAFKA_ENDPOINT": ""
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: "cassandra"
+  namespace: "data-pipeline"
+type: Opaque
+stringData:
+  "password": ""
+`
+
+func TestCollectEnvRequirements(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	requirements := collectEnvRequirements(builder.Environment.Deployments["predict-arrivals"], builder.Topology, builder.Environment)
+
+	expectedNames := []string{"ESTIMATED_ARRIVALS_KEYFIELD", "ESTIMATED_ARRIVALS_TOPIC", "KAFKA_ENDPOINT", "LOCATIONS_KEYFIELD", "LOCATIONS_TOPIC"}
+	if len(requirements) != len(expectedNames) {
+		t.Errorf("expected %d requirements, got %v", len(expectedNames), requirements)
+	}
+
+	for idx, requirement := range requirements {
+		if idx < len(expectedNames) && requirement.Name != expectedNames[idx] {
+			t.Errorf("requirement %d was %s, expected %s", idx, requirement.Name, expectedNames[idx])
+		}
+
+		if requirement.Name == "KAFKA_ENDPOINT" && len(requirement.UsedBy) != 2 {
+			t.Errorf("KAFKA_ENDPOINT should be needed by both connections, got %v", requirement.UsedBy)
+		}
+	}
+
+	envExample := FillEnvExample("write-locations", collectEnvRequirements(builder.Environment.Deployments["write-locations"], builder.Topology, builder.Environment))
+	if envExample != expectedWriteLocationsEnvExample {
+		t.Errorf(".env.example did not match:-->%s<-- vs. -->%s<--", envExample, expectedWriteLocationsEnvExample)
+	}
+}
+
+func TestFillSecretSkeleton(t *testing.T) {
+	requirements := []EnvRequirement{
+		{Name: "CASSANDRA_PASSWORD", SecretName: "cassandra", SecretKey: "password"},
+		{Name: "KAFKA_ENDPOINT"},
+	}
+
+	secretSkeleton := FillSecretSkeleton("write-locations", "data-pipeline", requirements)
+	if secretSkeleton != expectedSecretSkeleton {
+		t.Errorf("secret skeleton did not match:-->%s<-- vs. -->%s<--", secretSkeleton, expectedSecretSkeleton)
+	}
+}
+
+func TestCollectEnvRequirementsDefaults(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	builder.Environment.Connections["locations"].Config["endpoint"] = map[string]interface{}{"env": "KAFKA_ENDPOINT", "default": "localhost:9092"}
+
+	for _, requirement := range collectEnvRequirements(builder.Environment.Deployments["predict-arrivals"], builder.Topology, builder.Environment) {
+		if requirement.Name == "KAFKA_ENDPOINT" && (requirement.HasDefault || requirement.Default != nil) {
+			t.Errorf("KAFKA_ENDPOINT is read without a default by connection estimatedArrivals, so it should be required: %+v", requirement)
+		}
+	}
+
+	builder.Environment.Connections["estimatedArrivals"].Config["endpoint"] = map[string]interface{}{"env": "KAFKA_ENDPOINT", "default": "kafka:9092"}
+
+	for _, requirement := range collectEnvRequirements(builder.Environment.Deployments["predict-arrivals"], builder.Topology, builder.Environment) {
+		if requirement.Name == "KAFKA_ENDPOINT" && !requirement.HasDefault {
+			t.Errorf("KAFKA_ENDPOINT has a default everywhere it is read, so it should be optional: %+v", requirement)
+		}
+	}
+
+	diagnostics := builder.Validate()
+	expectedDiagnostic := `fixtures/environment.json:16:17 connections.locations.config.endpoint: KAFKA_ENDPOINT defaults to "localhost:9092" here, but to "kafka:9092" for connection estimatedArrivals: endpoint`
+	if !diagnostics.HasCode(CodeConflictingDefaults) {
+		t.Fatalf("expected a conflicting-defaults diagnostic, got: %v", diagnostics)
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == CodeConflictingDefaults && diagnostic.String() != expectedDiagnostic {
+			t.Errorf("diagnostic did not match:-->%s<-- vs. -->%s<--", diagnostic, expectedDiagnostic)
+		}
+	}
+}
@@ -6,7 +6,52 @@ type Environment struct {
 	Namespace     string
 	ContainerRepo string
 	PullSecret    string
+	ImageTag      string
+	StandIns      bool
+	Vars          map[string]interface{}
 	Connections   map[string]Connection
 	Processors    map[string]ProcessorEnv
 	Deployments   map[string]Deployment
 }
+
+// Targets an environment can deploy to. kubernetes is the original name of
+// kubernetes-helm.
+const (
+	TargetKubernetes          = "kubernetes"
+	TargetKubernetesHelm      = "kubernetes-helm"
+	TargetKubernetesManifests = "kubernetes-manifests"
+	TargetCompose             = "compose"
+	TargetSystemd             = "systemd"
+)
+
+var knownTargets = []string{TargetKubernetes, TargetKubernetesHelm, TargetKubernetesManifests, TargetCompose, TargetSystemd}
+
+// kubernetesTargets are the targets that deploy to Kubernetes, including no
+// target at all.
+var kubernetesTargets = []string{"", TargetKubernetes, TargetKubernetesHelm, TargetKubernetesManifests}
+
+// DeploymentTarget is the target a deployment is built for: its own target
+// if it overrides the environment's.
+func (e Environment) DeploymentTarget(deploymentID string) string {
+	if target := e.Deployments[deploymentID].Target; target != "" {
+		return target
+	}
+
+	return e.Target
+}
+
+// DeploymentsWithTarget lists, sorted, the deployments built for any of
+// targets.
+func (e Environment) DeploymentsWithTarget(targets ...string) (deploymentIDs []string) {
+	for _, deploymentID := range sortedDeploymentIds(e.Deployments) {
+		deploymentTarget := e.DeploymentTarget(deploymentID)
+		for _, target := range targets {
+			if deploymentTarget == target {
+				deploymentIDs = append(deploymentIDs, deploymentID)
+				break
+			}
+		}
+	}
+
+	return deploymentIDs
+}
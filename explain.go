@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ExplainedValue is one effective setting of a deployment, where it was
+// defined, and the values it overrode along the way.
+type ExplainedValue struct {
+	Setting    string       `json:"setting"`
+	Path       string       `json:"path"`
+	Value      interface{}  `json:"value"`
+	Default    bool         `json:"default,omitempty"`
+	Source     Position     `json:"source"`
+	Overridden []Provenance `json:"overridden,omitempty"`
+}
+
+var explainedDeploymentSettings = [][]string{
+	{"cpu", "request"},
+	{"cpu", "limit"},
+	{"memory", "request"},
+	{"memory", "limit"},
+	{"replicas", "min"},
+	{"replicas", "max"},
+	{"replicas", "lagThreshold"},
+	{"concurrency"},
+	{"logSeverity"},
+}
+
+// documentValue walks a generic document along keys.
+func documentValue(document interface{}, keys ...string) (value interface{}, ok bool) {
+	value = document
+	for _, key := range keys {
+		valueMap, isMap := value.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+
+		value, ok = valueMap[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+func documentPath(keys ...string) (path string) {
+	for _, key := range keys {
+		path = joinPath(path, key)
+	}
+
+	return path
+}
+
+func (b *Builder) explainValue(setting string, keys ...string) ExplainedValue {
+	path := documentPath(keys...)
+	explained := ExplainedValue{
+		Setting:    setting,
+		Path:       path,
+		Overridden: b.EnvironmentSource.Overridden(path),
+	}
+
+	value, ok := documentValue(b.EnvironmentDocument, keys...)
+	if !ok {
+		explained.Default = true
+		return explained
+	}
+
+	explained.Value = value
+	explained.Source, _ = b.EnvironmentSource.Lookup(path)
+
+	return explained
+}
+
+func sortedConfigKeys(config interface{}) []string {
+	configMap, _ := config.(map[string]interface{})
+
+	keys := make([]string, 0, len(configMap))
+	for key := range configMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Explain lists every effective setting of a deployment: its resources,
+// replicas and log severity, and the config of each connection and processor
+// it uses, each with the file and path that supplied it.
+func (b *Builder) Explain(deploymentID string) (values []ExplainedValue, err error) {
+	deployment, ok := b.Environment.Deployments[deploymentID]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown deployment %s", deploymentID))
+	}
+
+	for _, setting := range explainedDeploymentSettings {
+		keys := append([]string{"deployments", deploymentID}, setting...)
+		values = append(values, b.explainValue(documentPath(setting...), keys...))
+	}
+
+	connections := map[string]bool{}
+	for _, nodeId := range deployment.Nodes {
+		node := b.Topology.Nodes[nodeId]
+		for _, connectionId := range append(append([]string{}, node.Inputs...), node.Outputs...) {
+			connections[connectionId] = true
+		}
+	}
+
+	for _, connectionId := range sortedKeys(connections) {
+		config, _ := documentValue(b.EnvironmentDocument, "connections", connectionId, "config")
+		for _, key := range sortedConfigKeys(config) {
+			setting := documentPath("connections", connectionId, key)
+			values = append(values, b.explainValue(setting, "connections", connectionId, "config", key))
+		}
+	}
+
+	for _, nodeId := range deployment.Nodes {
+		config, _ := documentValue(b.EnvironmentDocument, "processors", nodeId, "config")
+		for _, key := range sortedConfigKeys(config) {
+			setting := documentPath("processors", nodeId, key)
+			values = append(values, b.explainValue(setting, "processors", nodeId, "config", key))
+		}
+	}
+
+	return values, nil
+}
+
+func formatPosition(position Position) string {
+	if position.Line == 0 {
+		return position.File
+	}
+
+	return fmt.Sprintf("%s:%d:%d", position.File, position.Line, position.Column)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/staging.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	values, err := builder.Explain("predict-arrivals")
+	if err != nil {
+		t.Errorf("Explain did not complete successfully: %s", err)
+	}
+
+	explained := map[string]ExplainedValue{}
+	for _, value := range values {
+		explained[value.Setting] = value
+	}
+
+	cpuLimit := explained["cpu.limit"]
+	if fmt.Sprint(cpuLimit.Value) != "500m" || cpuLimit.Source.File != "fixtures/overlays/staging.yaml" {
+		t.Errorf("cpu.limit was not explained correctly: %+v", cpuLimit)
+	}
+
+	if len(cpuLimit.Overridden) != 1 || fmt.Sprint(cpuLimit.Overridden[0].Value) != "1000m" || cpuLimit.Overridden[0].Position.File != "fixtures/environment.json" {
+		t.Errorf("cpu.limit override was not recorded: %+v", cpuLimit.Overridden)
+	}
+
+	if !explained["replicas.max"].Default {
+		t.Errorf("replicas.max should fall back to its default")
+	}
+
+	topic := explained["connections.locations.topic"]
+	if topic.Path != "connections.locations.config.topic" || topic.Source.File != "fixtures/environment.json" {
+		t.Errorf("locations topic was not explained correctly: %+v", topic)
+	}
+
+	if _, ok := explained["connections.locations.endpoint"]; !ok {
+		t.Errorf("locations endpoint was not explained")
+	}
+
+	_, err = builder.Explain("missing-deployment")
+	if err == nil {
+		t.Errorf("Explain should fail for an unknown deployment")
+	}
+}
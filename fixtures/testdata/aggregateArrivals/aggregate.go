@@ -0,0 +1,17 @@
+package aggregateArrivals
+
+import (
+	topological "github.com/timfpark/topological-go"
+)
+
+type processor struct {
+	config topological.Config
+}
+
+func NewProcessor(config topological.Config) (topological.Processor, error) {
+	return &processor{config: config}, nil
+}
+
+func (p *processor) Process(message topological.Message) error {
+	return nil
+}
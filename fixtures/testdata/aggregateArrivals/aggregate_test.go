@@ -0,0 +1,9 @@
+package aggregateArrivals
+
+import "testing"
+
+func TestNewProcessor(t *testing.T) {
+	if _, err := NewProcessor(nil); err != nil {
+		t.Errorf("NewProcessor failed: %s", err)
+	}
+}
@@ -0,0 +1,4 @@
+package window
+
+// Seconds is the default length of an aggregation window.
+const Seconds = 60
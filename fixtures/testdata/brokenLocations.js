@@ -0,0 +1,4 @@
+const { Processor } = require('topological'),
+    geo = require('./lib/missing');
+
+module.exports = class BrokenLocations extends Processor {};
@@ -0,0 +1,11 @@
+const { Processor } = require('topological'),
+    geo = require('./lib/geo');
+
+class EnrichLocations extends Processor {
+    process(message, callback) {
+        message.body.region = geo.region(message.body);
+        return callback();
+    }
+}
+
+module.exports = EnrichLocations;
@@ -0,0 +1,3 @@
+const bounds = require('./bounds.json');
+
+module.exports.region = location => bounds.find(region => location.latitude >= region.south && location.latitude <= region.north);
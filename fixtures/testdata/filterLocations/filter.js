@@ -0,0 +1,10 @@
+const { Processor } = require('topological');
+const { inBounds } = require('./lib/geo');
+
+class FilterLocations extends Processor {
+    process(message, callback) {
+        return callback(null, inBounds(message.body) ? message : null);
+    }
+}
+
+module.exports = FilterLocations;
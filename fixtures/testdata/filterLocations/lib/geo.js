@@ -0,0 +1 @@
+module.exports.inBounds = location => Math.abs(location.latitude) <= 90 && Math.abs(location.longitude) <= 180;
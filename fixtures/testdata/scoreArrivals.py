@@ -0,0 +1,6 @@
+from topological import Processor as BaseProcessor
+
+
+class Processor(BaseProcessor):
+    def process(self, message):
+        return None
@@ -0,0 +1,12 @@
+import { Processor } from 'topological';
+import type { WriteLocationsConfig } from '../stage';
+
+export default class WriteLocations extends Processor {
+    constructor(options: { id: string, config: WriteLocationsConfig }) {
+        super(options);
+    }
+
+    process(message: unknown, callback: (err?: Error) => void) {
+        return callback();
+    }
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const goPlatform = "go"
+
+// goStageModule is the module path of the generated stage. Local processor
+// packages are copied into it and imported as goStageModule/processors/<name>.
+const goStageModule = "stage"
+
+// goRuntimeModule is the runtime the generated main.go wires the stage with.
+// A connection package exports
+//
+//	func NewConnection(config topological.Config) (topological.Connection, error)
+//
+// and a processor package
+//
+//	func NewProcessor(config topological.Config) (topological.Processor, error)
+const goRuntimeModule = "github.com/timfpark/topological-go"
+
+// goRequirements are the modules every generated main.go imports.
+var goRequirements = map[string]string{
+	goRuntimeModule:                       "v1.0.0",
+	"github.com/prometheus/client_golang": "v1.17.0",
+}
+
+type GoPlatformBuilder struct {
+	DeploymentID string
+	Deployment   Deployment
+	Topology     Topology
+	Environment  Environment
+
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+
+	DeploymentPath string
+	CodePath       string
+	ProcessorPath  string
+}
+
+func init() {
+	RegisterPlatformBuilder(goPlatform, func(context PlatformContext) PlatformBuilder {
+		return &GoPlatformBuilder{
+			DeploymentID:      context.DeploymentID,
+			Deployment:        context.Deployment,
+			Topology:          context.Topology,
+			Environment:       context.Environment,
+			TopologySource:    context.TopologySource,
+			EnvironmentSource: context.EnvironmentSource,
+		}
+	})
+}
+
+const goDockerFile = `FROM golang:1.21 AS build
+
+WORKDIR /src
+
+COPY . .
+RUN CGO_ENABLED=0 go build -mod=mod -o /stage .
+
+FROM gcr.io/distroless/static-debian12
+
+COPY --from=build /stage /stage
+
+ENV PORT=80
+EXPOSE 80
+
+ENTRYPOINT [ "/stage" ]
+`
+
+// isLocalGoPackage tells processor packages that live next to the topology,
+// e.g. ./processors/aggregate, from import paths of other modules.
+func isLocalGoPackage(packagePath string) bool {
+	return strings.HasPrefix(packagePath, "./") || strings.HasPrefix(packagePath, "../")
+}
+
+// goModuleVersionPattern matches the exact versions go.mod requires, with or
+// without their leading v, including pseudo-versions.
+var goModuleVersionPattern = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// goModuleVersion turns a declared version into a module version, e.g.
+// 1.0.4 into v1.0.4.
+func goModuleVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	return version
+}
+
+// processorImportPath is the path the stage imports the processor package of
+// a node from.
+func (b *GoPlatformBuilder) processorImportPath(nodeId string) string {
+	packagePath := b.Topology.Nodes[nodeId].Processor.File
+	if isLocalGoPackage(packagePath) {
+		return path.Join(goStageModule, "processors", processorCopyPath(packagePath))
+	}
+
+	return packagePath
+}
+
+// connectionPackage is the package a connection is created with: the first
+// of its dependencies, the others only being required by go.mod.
+func (b *GoPlatformBuilder) connectionPackage(connectionId string) string {
+	packages := []string{}
+	for packageName := range b.Environment.Connections[connectionId].Dependencies {
+		packages = append(packages, packageName)
+	}
+	sort.Strings(packages)
+
+	if len(packages) == 0 {
+		return ""
+	}
+
+	return packages[0]
+}
+
+// Validate checks that the connections of the deployment are Go modules
+// with a package to create them with, that local processor packages are
+// copied to distinct directories and that remote processor packages belong
+// to a module the node depends on, of one exact version every requester
+// agrees on.
+func (b *GoPlatformBuilder) Validate() (diagnostics Diagnostics) {
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		platform := b.Environment.Connections[connectionId].Platform
+		if platform != "" && platform != goPlatform {
+			diagnostics.Errorf(CodeMismatchedPlatform, b.EnvironmentSource, joinPath(joinPath("connections", connectionId), "platform"), "connection %q is built for platform %s, but deployment %q runs %s", connectionId, platform, b.DeploymentID, goPlatform)
+		}
+
+		if b.connectionPackage(connectionId) == "" {
+			diagnostics.Errorf(CodeInvalidDependency, b.EnvironmentSource, joinPath(joinPath("connections", connectionId), "dependencies"), "connection %q has no dependencies, so deployment %q has no package to create it with", connectionId, b.DeploymentID)
+		}
+	}
+
+	localPackages := map[string]string{}
+	for _, nodeId := range b.Deployment.Nodes {
+		processor := b.Topology.Nodes[nodeId].Processor
+		if isLocalGoPackage(processor.File) {
+			dir := processorCopyPath(processor.File)
+			if packagePath, ok := localPackages[dir]; ok && path.Clean(packagePath) != path.Clean(processor.File) {
+				diagnostics.Errorf(CodeInvalidProcessor, b.TopologySource, joinPath(joinPath("nodes", nodeId), "processor.file"), "processor package %s of node %q would be copied to processors/%s along with %s", processor.File, nodeId, dir, packagePath)
+			}
+			localPackages[dir] = processor.File
+			continue
+		}
+
+		declared := false
+		for modulePath := range processor.Dependencies {
+			if processor.File == modulePath || strings.HasPrefix(processor.File, modulePath+"/") {
+				declared = true
+			}
+		}
+
+		if !declared {
+			diagnostics.Errorf(CodeInvalidProcessor, b.TopologySource, joinPath(joinPath("nodes", nodeId), "processor.file"), "processor package %s of node %q is not part of a module listed in its dependencies", processor.File, nodeId)
+		}
+	}
+
+	// go.mod takes one exact version per module rather than a range
+	resolved := b.resolvedDependencies()
+	for _, dependency := range resolved {
+		for _, request := range dependency.RequestedBy {
+			if goModuleVersionPattern.MatchString(strings.TrimSpace(request.Range)) {
+				continue
+			}
+
+			if request.Kind == "connection" {
+				diagnostics.Errorf(CodeInvalidDependency, b.EnvironmentSource, joinPath(joinPath(joinPath("connections", request.ID), "dependencies"), dependency.Name), "version %q of %s is not an exact module version such as v1.2.3", request.Range, dependency.Name)
+			} else {
+				diagnostics.Errorf(CodeInvalidDependency, b.TopologySource, joinPath(joinPath(joinPath("nodes", request.ID), "processor.dependencies"), dependency.Name), "version %q of %s is not an exact module version such as v1.2.3", request.Range, dependency.Name)
+			}
+		}
+	}
+
+	return append(diagnostics, dependencyConflicts(resolved, b.TopologySource, b.EnvironmentSource)...)
+}
+
+func (b *GoPlatformBuilder) Image() PlatformImage {
+	return PlatformImage{
+		Dockerfile: goDockerFile,
+		Install:    []string{"go", "build", "-mod=mod", "-o", "stage", "."},
+		Command:    []string{"./stage"},
+	}
+}
+
+// resolvedDependencies resolves the module versions that the processors of
+// the deployment and the connections they use ask for.
+func (b *GoPlatformBuilder) resolvedDependencies() []ResolvedDependency {
+	return resolveDependencies(collectDependencies(b.Deployment.Nodes, b.Topology, b.Environment))
+}
+
+// Dependencies maps every package to the version that satisfies all of its
+// requesters. Conflicting packages, which Validate reports, keep the version
+// of their last requester.
+func (b *GoPlatformBuilder) Dependencies() (dependencies map[string]string) {
+	return dependencyVersions(b.resolvedDependencies())
+}
+
+// FillGoMod renders the go.mod of the stage. go.sum is left for the build to
+// fill in with -mod=mod.
+func (b *GoPlatformBuilder) FillGoMod() (goMod string) {
+	dependencies := b.Dependencies()
+	for modulePath, version := range goRequirements {
+		if _, ok := dependencies[modulePath]; !ok {
+			dependencies[modulePath] = version
+		}
+	}
+
+	requirements := []string{}
+	for modulePath, version := range dependencies {
+		requirements = append(requirements, fmt.Sprintf("\t%s %s", modulePath, goModuleVersion(version)))
+	}
+
+	sort.Strings(requirements)
+
+	return fmt.Sprintf(`module %s
+
+go 1.21
+
+require (
+%s
+)
+`, goStageModule, strings.Join(requirements, "\n"))
+}
+
+func (b *GoPlatformBuilder) FillImports() (imports string) {
+	// imports are sorted by path like gofmt does, and then by name
+	importNames := map[string]string{}
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		if packageName := b.connectionPackage(connectionId); packageName != "" {
+			importNames[connectionId+"ConnectionPackage"] = packageName
+		}
+	}
+
+	for _, nodeId := range b.Deployment.Nodes {
+		importNames[nodeId+"ProcessorPackage"] = b.processorImportPath(nodeId)
+	}
+
+	names := make([]string, 0, len(importNames))
+	for name := range importNames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if importNames[names[i]] != importNames[names[j]] {
+			return importNames[names[i]] < importNames[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	packageImports := []string{}
+	for _, name := range names {
+		packageImports = append(packageImports, fmt.Sprintf("\t%s %s", name, jsonLiteral(importNames[name])))
+	}
+
+	return fmt.Sprintf(`import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	topological %s
+
+%s
+)`, jsonLiteral(goRuntimeModule), strings.Join(packageImports, "\n"))
+}
+
+func (b *GoPlatformBuilder) buildConfig(config map[string]interface{}) (configGo string) {
+	values, err := ParseConfig(config)
+	if err != nil {
+		// config is validated before any code is generated
+		return "nil"
+	}
+
+	return goMap(values)
+}
+
+// FillRequiredEnv lists the environment variables without a default that
+// the connections and processors read, which main checks before anything is
+// created.
+func (b *GoPlatformBuilder) FillRequiredEnv() (requiredEnv string) {
+	entries := []string{}
+	for _, requirement := range collectEnvRequirements(b.Deployment, b.Topology, b.Environment) {
+		if requirement.HasDefault {
+			continue
+		}
+
+		usages := []string{}
+		for _, usage := range requirement.UsedBy {
+			usages = append(usages, jsonLiteral(usage.String()))
+		}
+		entries = append(entries, fmt.Sprintf("\t{%s, []string{%s}},", jsonLiteral(requirement.Name), strings.Join(usages, ", ")))
+	}
+
+	return fmt.Sprintf(`var requiredEnv = []struct {
+	name   string
+	usedBy []string
+}{
+%s
+}
+
+func envOr(name string, fallback interface{}) interface{} {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	return fallback
+}`, strings.Join(entries, "\n"))
+}
+
+func (b *GoPlatformBuilder) FillConnections() (connectionInstantiations string) {
+	instantiations := []string{}
+
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		connectionConfig := b.buildConfig(b.Environment.Connections[connectionId].Config)
+		instantiations = append(instantiations, fmt.Sprintf(`	%[1]sConnection, err := %[1]sConnectionPackage.NewConnection(topological.Config{
+		ID:     "%[1]s",
+		Config: %[2]s,
+	})
+	if err != nil {
+		log.Fatalf("creating connection %[1]s failed with: %%s", err)
+	}`, connectionId, connectionConfig))
+	}
+
+	return strings.Join(instantiations, "\n\n")
+}
+
+func (b *GoPlatformBuilder) FillProcessors() (processorInstantiations string) {
+	instantiations := []string{}
+
+	for _, nodeID := range b.Deployment.Nodes {
+		processorConfig := b.buildConfig(b.Environment.Processors[nodeID].Config)
+		instantiations = append(instantiations, fmt.Sprintf(`	%[1]sProcessor, err := %[1]sProcessorPackage.NewProcessor(topological.Config{
+		ID:     "%[1]s",
+		Config: %[2]s,
+	})
+	if err != nil {
+		log.Fatalf("creating processor %[1]s failed with: %%s", err)
+	}`, nodeID, processorConfig))
+	}
+
+	sort.Strings(instantiations)
+
+	return strings.Join(instantiations, "\n\n")
+}
+
+func (b *GoPlatformBuilder) FillTopology() (topologyInstantiation string) {
+	nodes := []string{}
+
+	for _, nodeId := range b.Deployment.Nodes {
+		node := b.Topology.Nodes[nodeId]
+
+		nodes = append(nodes, fmt.Sprintf(`		topological.NewNode("%s",
+			[]topological.Connection{%s},
+			%sProcessor,
+			[]topological.Connection{%s}),`, nodeId, strings.Join(buildConnectionInstanceNamesFromIds(node.Inputs), ", "), nodeId, strings.Join(buildConnectionInstanceNamesFromIds(node.Outputs), ", ")))
+	}
+
+	return fmt.Sprintf(`	topology := topological.NewTopology("topology", []*topological.Node{
+%s
+	})`, strings.Join(nodes, "\n"))
+}
+
+// FillMain renders main.go, which checks the environment, creates the
+// connections and processors, serves /metrics on PORT and runs the topology.
+// Connections and processors are declared with := so that err is declared
+// by the first of them.
+func (b *GoPlatformBuilder) FillMain() (main string) {
+	return fmt.Sprintf(`package main
+
+%s
+
+// CONFIGURATION ===========================================================
+
+%s
+
+func main() {
+	missingEnv := false
+	for _, env := range requiredEnv {
+		if _, ok := os.LookupEnv(env.name); !ok {
+			fmt.Fprintf(os.Stderr, "missing environment variable %%s needed by %%s\n", env.name, strings.Join(env.usedBy, ", "))
+			missingEnv = true
+		}
+	}
+	if missingEnv {
+		os.Exit(1)
+	}
+
+	// CONNECTIONS =========================================================
+
+%s
+
+	// PROCESSORS ==========================================================
+
+%s
+
+	// TOPOLOGY ============================================================
+
+%s
+
+	// METRICS =============================================================
+
+	http.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(":"+os.Getenv("PORT"), nil))
+	}()
+	log.Printf("listening on port: %%s", os.Getenv("PORT"))
+
+	if err := topology.Start(); err != nil {
+		log.Fatalf("topology start failed with: %%s", err)
+	}
+}
+`, b.FillImports(), b.FillRequiredEnv(), b.FillConnections(), b.FillProcessors(), b.FillTopology())
+}
+
+// copyGoPackage copies a package directory with its subpackages, leaving out
+// tests, which have no place in the image.
+func copyGoPackage(packagePath string, packageDir string) (err error) {
+	if err = os.MkdirAll(packageDir, 0755); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(packagePath)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			err = copyGoPackage(path.Join(packagePath, file.Name()), path.Join(packageDir, file.Name()))
+		} else if !strings.HasSuffix(file.Name(), "_test.go") {
+			err = CopyFile(path.Join(packagePath, file.Name()), path.Join(packageDir, file.Name()))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyProcessors copies local processor packages, with their subpackages,
+// into the processors directory of the stage module. Packages of other
+// modules are fetched by the Go build.
+func (b *GoPlatformBuilder) CopyProcessors() (err error) {
+	for _, nodeId := range b.Deployment.Nodes {
+		packagePath := b.Topology.Nodes[nodeId].Processor.File
+		if !isLocalGoPackage(packagePath) {
+			continue
+		}
+
+		if err = copyGoPackage(packagePath, path.Join(b.ProcessorPath, processorCopyPath(packagePath))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *GoPlatformBuilder) BuildSource() (err error) {
+	b.DeploymentPath = path.Join("build", b.Environment.Tier, b.DeploymentID)
+
+	err = ioutil.WriteFile(path.Join(b.DeploymentPath, "Dockerfile"), []byte(b.Image().Dockerfile), 0644)
+	if err != nil {
+		return err
+	}
+
+	b.CodePath = b.DeploymentPath
+
+	b.ProcessorPath = path.Join(b.CodePath, "processors")
+	err = os.Mkdir(b.ProcessorPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(b.CodePath, "go.mod"), []byte(b.FillGoMod()), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(b.CodePath, "main.go"), []byte(b.FillMain()), 0644)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyProcessors()
+}
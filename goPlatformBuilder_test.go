@@ -0,0 +1,244 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const expectedGoMod = `module stage
+
+go 1.21
+
+require (
+	github.com/acme/arrivals v0.3.1
+	github.com/prometheus/client_golang v1.17.0
+	github.com/timfpark/topological-go v1.0.0
+	github.com/timfpark/topological-kafka-go v1.0.4
+)
+`
+
+const expectedMainGo = `package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	topological "github.com/timfpark/topological-go"
+
+	archiveArrivalsProcessorPackage "github.com/acme/arrivals/archive"
+	arrivalCountsConnectionPackage "github.com/timfpark/topological-kafka-go"
+	estimatedArrivalsConnectionPackage "github.com/timfpark/topological-kafka-go"
+	aggregateArrivalsProcessorPackage "stage/processors/fixtures/testdata/aggregateArrivals"
+)
+
+// CONFIGURATION ===========================================================
+
+var requiredEnv = []struct {
+	name   string
+	usedBy []string
+}{
+	{"ARRIVAL_COUNTS_TOPIC", []string{"connection arrivalCounts: topic"}},
+	{"ESTIMATED_ARRIVALS_TOPIC", []string{"connection estimatedArrivals: topic"}},
+	{"KAFKA_ENDPOINT", []string{"connection arrivalCounts: endpoint", "connection estimatedArrivals: endpoint"}},
+}
+
+func envOr(name string, fallback interface{}) interface{} {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	return fallback
+}
+
+func main() {
+	missingEnv := false
+	for _, env := range requiredEnv {
+		if _, ok := os.LookupEnv(env.name); !ok {
+			fmt.Fprintf(os.Stderr, "missing environment variable %s needed by %s\n", env.name, strings.Join(env.usedBy, ", "))
+			missingEnv = true
+		}
+	}
+	if missingEnv {
+		os.Exit(1)
+	}
+
+	// CONNECTIONS =========================================================
+
+	arrivalCountsConnection, err := arrivalCountsConnectionPackage.NewConnection(topological.Config{
+		ID:     "arrivalCounts",
+		Config: map[string]interface{}{"endpoint": os.Getenv("KAFKA_ENDPOINT"), "topic": os.Getenv("ARRIVAL_COUNTS_TOPIC")},
+	})
+	if err != nil {
+		log.Fatalf("creating connection arrivalCounts failed with: %s", err)
+	}
+
+	estimatedArrivalsConnection, err := estimatedArrivalsConnectionPackage.NewConnection(topological.Config{
+		ID:     "estimatedArrivals",
+		Config: map[string]interface{}{"endpoint": os.Getenv("KAFKA_ENDPOINT"), "topic": os.Getenv("ESTIMATED_ARRIVALS_TOPIC")},
+	})
+	if err != nil {
+		log.Fatalf("creating connection estimatedArrivals failed with: %s", err)
+	}
+
+	// PROCESSORS ==========================================================
+
+	aggregateArrivalsProcessor, err := aggregateArrivalsProcessorPackage.NewProcessor(topological.Config{
+		ID:     "aggregateArrivals",
+		Config: map[string]interface{}{"keys": []interface{}{"route", "stop"}, "window": envOr("WINDOW_SECONDS", 60)},
+	})
+	if err != nil {
+		log.Fatalf("creating processor aggregateArrivals failed with: %s", err)
+	}
+
+	archiveArrivalsProcessor, err := archiveArrivalsProcessorPackage.NewProcessor(topological.Config{
+		ID:     "archiveArrivals",
+		Config: map[string]interface{}{},
+	})
+	if err != nil {
+		log.Fatalf("creating processor archiveArrivals failed with: %s", err)
+	}
+
+	// TOPOLOGY ============================================================
+
+	topology := topological.NewTopology("topology", []*topological.Node{
+		topological.NewNode("aggregateArrivals",
+			[]topological.Connection{estimatedArrivalsConnection},
+			aggregateArrivalsProcessor,
+			[]topological.Connection{arrivalCountsConnection}),
+		topological.NewNode("archiveArrivals",
+			[]topological.Connection{arrivalCountsConnection},
+			archiveArrivalsProcessor,
+			[]topological.Connection{}),
+	})
+
+	// METRICS =============================================================
+
+	http.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(":"+os.Getenv("PORT"), nil))
+	}()
+	log.Printf("listening on port: %s", os.Getenv("PORT"))
+
+	if err := topology.Start(); err != nil {
+		log.Fatalf("topology start failed with: %s", err)
+	}
+}
+`
+
+func TestFillGoMod(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/go-topology.json", "fixtures/go-environment.json", "aggregate-arrivals", "")
+
+	goMod := platformBuilder.(*GoPlatformBuilder).FillGoMod()
+	if goMod != expectedGoMod {
+		t.Errorf("go.mod did not match:-->%s<-- vs. -->%s<--", goMod, expectedGoMod)
+	}
+}
+
+func TestFillMainGo(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/go-topology.json", "fixtures/go-environment.json", "aggregate-arrivals", "")
+
+	mainGo := platformBuilder.(*GoPlatformBuilder).FillMain()
+	if mainGo != expectedMainGo {
+		t.Errorf("main.go did not match:-->%s<-- vs. -->%s<--", mainGo, expectedMainGo)
+	}
+}
+
+func TestGoPlatformBuilderValidate(t *testing.T) {
+	builder, loadedBuilder := loadPlatformBuilder(t, "fixtures/go-topology.json", "fixtures/go-environment.json", "aggregate-arrivals", "")
+	platformBuilder := loadedBuilder.(*GoPlatformBuilder)
+
+	// remote processor packages are not files the validator can stat
+	if diagnostics := builder.Validate(); diagnostics.HasErrors() {
+		t.Errorf("expected no errors with go fixtures, got: %v", diagnostics)
+	}
+
+	node := platformBuilder.Topology.Nodes["archiveArrivals"]
+	node.Processor.Dependencies = nil
+	platformBuilder.Topology.Nodes["archiveArrivals"] = node
+
+	diagnostics := platformBuilder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeInvalidProcessor) {
+		t.Errorf("expected one invalid-processor diagnostic, got: %v", diagnostics)
+	}
+
+	// packages with the same name in different directories do not collide
+	node.Processor.File = "./fixtures/aggregateArrivals"
+	platformBuilder.Topology.Nodes["archiveArrivals"] = node
+	if diagnostics := platformBuilder.Validate(); len(diagnostics) != 0 {
+		t.Errorf("expected no problems with distinct local packages, got: %v", diagnostics)
+	}
+
+	node.Processor.File = "../fixtures/testdata/aggregateArrivals"
+	platformBuilder.Topology.Nodes["archiveArrivals"] = node
+	if diagnostics := platformBuilder.Validate(); len(diagnostics) != 1 || !diagnostics.HasCode(CodeInvalidProcessor) {
+		t.Errorf("expected one invalid-processor diagnostic for colliding local packages, got: %v", diagnostics)
+	}
+
+	connection := platformBuilder.Environment.Connections["arrivalCounts"]
+	connection.Dependencies = nil
+	platformBuilder.Environment.Connections["arrivalCounts"] = connection
+
+	diagnostics = platformBuilder.Validate()
+	if !diagnostics.HasCode(CodeInvalidDependency) {
+		t.Errorf("expected an invalid-dependency diagnostic for a connection without dependencies, got: %v", diagnostics)
+	}
+
+	node.Processor.Dependencies = map[string]string{"github.com/timfpark/topological-kafka-go": "v2.0.0"}
+	platformBuilder.Topology.Nodes["archiveArrivals"] = node
+
+	diagnostics = platformBuilder.Validate()
+	if !diagnostics.HasCode(CodeDependencyConflict) {
+		t.Errorf("expected a dependency-conflict diagnostic, got: %v", diagnostics)
+	}
+
+	node.Processor.Dependencies = map[string]string{"github.com/acme/arrivals": ">=1.2.0 <2.0.0"}
+	platformBuilder.Topology.Nodes["archiveArrivals"] = node
+
+	diagnostics = platformBuilder.Validate()
+	expectedDiagnostic := `nodes.archiveArrivals.processor.dependencies.github.com/acme/arrivals: version ">=1.2.0 <2.0.0" of github.com/acme/arrivals is not an exact module version such as v1.2.3`
+	if !diagnostics.HasCode(CodeInvalidDependency) || !strings.Contains(diagnostics.Error(), expectedDiagnostic) {
+		t.Errorf("expected an invalid-dependency diagnostic for a version range, got: %v", diagnostics)
+	}
+}
+
+func TestCopyGoPackage(t *testing.T) {
+	directory, err := ioutil.TempDir("", "topo")
+	if err != nil {
+		t.Errorf("could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(directory)
+
+	if err = copyGoPackage("./fixtures/testdata/aggregateArrivals", directory); err != nil {
+		t.Errorf("could not copy package: %s", err)
+	}
+
+	for _, file := range []string{"aggregate.go", "window/window.go"} {
+		if _, err := os.Stat(path.Join(directory, file)); err != nil {
+			t.Errorf("package file %s was not copied: %s", file, err)
+		}
+	}
+
+	if _, err := os.Stat(path.Join(directory, "aggregate_test.go")); !os.IsNotExist(err) {
+		t.Errorf("tests of the package should not be copied")
+	}
+}
+
+func TestGoModuleVersion(t *testing.T) {
+	versions := map[string]string{
+		"v1.0.4": "v1.0.4",
+		"1.0.4":  "v1.0.4",
+	}
+
+	for version, expectedVersion := range versions {
+		if moduleVersion := goModuleVersion(version); moduleVersion != expectedVersion {
+			t.Errorf("module version did not match:-->%s<-- vs. -->%s<--", moduleVersion, expectedVersion)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"sort"
+)
+
+// Graph is the dataflow graph of a topology: nodes are joined by an edge
+// whenever one writes to a connection that the other reads from.
+type Graph struct {
+	Nodes   map[string]Node
+	Readers map[string][]string
+	Writers map[string][]string
+}
+
+func NewGraph(topology Topology) *Graph {
+	graph := &Graph{
+		Nodes:   topology.Nodes,
+		Readers: map[string][]string{},
+		Writers: map[string][]string{},
+	}
+
+	for _, nodeId := range sortedNodeIds(topology.Nodes) {
+		node := topology.Nodes[nodeId]
+		for _, connectionId := range node.Inputs {
+			graph.Readers[connectionId] = append(graph.Readers[connectionId], nodeId)
+		}
+		for _, connectionId := range node.Outputs {
+			graph.Writers[connectionId] = append(graph.Writers[connectionId], nodeId)
+		}
+	}
+
+	return graph
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Connections returns every connection referenced by the topology.
+func (g *Graph) Connections() []string {
+	connections := map[string]bool{}
+	for connectionId := range g.Readers {
+		connections[connectionId] = true
+	}
+	for connectionId := range g.Writers {
+		connections[connectionId] = true
+	}
+
+	return sortedKeys(connections)
+}
+
+// Successors returns the nodes that read from any of nodeId's outputs.
+func (g *Graph) Successors(nodeId string) []string {
+	successors := map[string]bool{}
+	for _, connectionId := range g.Nodes[nodeId].Outputs {
+		for _, readerId := range g.Readers[connectionId] {
+			successors[readerId] = true
+		}
+	}
+
+	return sortedKeys(successors)
+}
+
+// UnreadConnections returns connections that are written but never read.
+func (g *Graph) UnreadConnections() (connections []string) {
+	for _, connectionId := range g.Connections() {
+		if len(g.Readers[connectionId]) == 0 {
+			connections = append(connections, connectionId)
+		}
+	}
+
+	return connections
+}
+
+// UnwrittenConnections returns connections that are read but never written,
+// which must be fed from outside the topology.
+func (g *Graph) UnwrittenConnections() (connections []string) {
+	for _, connectionId := range g.Connections() {
+		if len(g.Writers[connectionId]) == 0 {
+			connections = append(connections, connectionId)
+		}
+	}
+
+	return connections
+}
+
+// Sources returns the nodes data enters the topology through: nodes without
+// inputs and nodes reading a connection that no node writes.
+func (g *Graph) Sources() (sources []string) {
+	for _, nodeId := range sortedNodeIds(g.Nodes) {
+		node := g.Nodes[nodeId]
+		isSource := len(node.Inputs) == 0
+		for _, connectionId := range node.Inputs {
+			if len(g.Writers[connectionId]) == 0 {
+				isSource = true
+			}
+		}
+
+		if isSource {
+			sources = append(sources, nodeId)
+		}
+	}
+
+	return sources
+}
+
+// Unreachable returns the nodes that no data from any source can reach.
+func (g *Graph) Unreachable() (unreachable []string) {
+	reached := map[string]bool{}
+	pending := g.Sources()
+
+	for len(pending) > 0 {
+		nodeId := pending[0]
+		pending = pending[1:]
+
+		if reached[nodeId] {
+			continue
+		}
+		reached[nodeId] = true
+
+		pending = append(pending, g.Successors(nodeId)...)
+	}
+
+	for _, nodeId := range sortedNodeIds(g.Nodes) {
+		if !reached[nodeId] {
+			unreachable = append(unreachable, nodeId)
+		}
+	}
+
+	return unreachable
+}
+
+// Cycles returns each group of nodes that feed back into one another, found
+// as the strongly connected components of the graph. Each cycle is sorted.
+func (g *Graph) Cycles() (cycles [][]string) {
+	index := 0
+	indices := map[string]int{}
+	lowlinks := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+
+	var connect func(nodeId string)
+	connect = func(nodeId string) {
+		indices[nodeId] = index
+		lowlinks[nodeId] = index
+		index++
+		stack = append(stack, nodeId)
+		onStack[nodeId] = true
+
+		for _, successorId := range g.Successors(nodeId) {
+			if _, visited := indices[successorId]; !visited {
+				connect(successorId)
+				if lowlinks[successorId] < lowlinks[nodeId] {
+					lowlinks[nodeId] = lowlinks[successorId]
+				}
+			} else if onStack[successorId] && indices[successorId] < lowlinks[nodeId] {
+				lowlinks[nodeId] = indices[successorId]
+			}
+		}
+
+		if lowlinks[nodeId] != indices[nodeId] {
+			return
+		}
+
+		component := []string{}
+		for {
+			memberId := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[memberId] = false
+			component = append(component, memberId)
+			if memberId == nodeId {
+				break
+			}
+		}
+
+		if len(component) > 1 || g.feedsItself(nodeId) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, nodeId := range sortedNodeIds(g.Nodes) {
+		if _, visited := indices[nodeId]; !visited {
+			connect(nodeId)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+
+	return cycles
+}
+
+func (g *Graph) feedsItself(nodeId string) bool {
+	for _, successorId := range g.Successors(nodeId) {
+		if successorId == nodeId {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type graphVertex struct {
+	ID         string
+	Label      string
+	External   bool
+	Deployment string
+}
+
+type graphEdge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// GraphRenderer draws a topology's dataflow graph. When an environment is
+// supplied, nodes are grouped by deployment and edges carry connection config.
+type GraphRenderer struct {
+	Topology    Topology
+	Environment *Environment
+	Graph       *Graph
+}
+
+func NewGraphRenderer(topology Topology, environment *Environment) *GraphRenderer {
+	return &GraphRenderer{
+		Topology:    topology,
+		Environment: environment,
+		Graph:       NewGraph(topology),
+	}
+}
+
+func externalVertexID(connectionId string) string {
+	return "connection:" + connectionId
+}
+
+func (r *GraphRenderer) nodeDeployments() map[string]string {
+	deployments := map[string]string{}
+	if r.Environment == nil {
+		return deployments
+	}
+
+	for _, deploymentID := range sortedDeploymentIds(r.Environment.Deployments) {
+		for _, nodeId := range r.Environment.Deployments[deploymentID].Nodes {
+			if _, ok := deployments[nodeId]; !ok {
+				deployments[nodeId] = deploymentID
+			}
+		}
+	}
+
+	return deployments
+}
+
+// vertices returns the topology's nodes plus a vertex for every connection
+// that enters or leaves the topology, since those have no node on one end.
+func (r *GraphRenderer) vertices() (vertices []graphVertex) {
+	deployments := r.nodeDeployments()
+
+	for _, nodeId := range sortedNodeIds(r.Topology.Nodes) {
+		vertices = append(vertices, graphVertex{
+			ID:         nodeId,
+			Label:      nodeId,
+			Deployment: deployments[nodeId],
+		})
+	}
+
+	for _, connectionId := range r.Graph.Connections() {
+		if len(r.Graph.Writers[connectionId]) == 0 || len(r.Graph.Readers[connectionId]) == 0 {
+			vertices = append(vertices, graphVertex{
+				ID:       externalVertexID(connectionId),
+				Label:    connectionId,
+				External: true,
+			})
+		}
+	}
+
+	return vertices
+}
+
+func (r *GraphRenderer) connectionLabel(connectionId string) []string {
+	lines := []string{connectionId}
+	if r.Environment == nil {
+		return lines
+	}
+
+	connection, ok := r.Environment.Connections[connectionId]
+	if !ok {
+		return lines
+	}
+
+	if connection.Platform != "" {
+		lines = append(lines, fmt.Sprintf("platform: %s", connection.Platform))
+	}
+	if topic, ok := connection.Config["topic"]; ok {
+		if topicValue, err := ParseConfigValue(topic); err == nil {
+			lines = append(lines, fmt.Sprintf("topic: %s", topicValue.Describe()))
+		}
+	}
+
+	return lines
+}
+
+func (r *GraphRenderer) edges(lineSeparator string) (edges []graphEdge) {
+	for _, connectionId := range r.Graph.Connections() {
+		label := strings.Join(r.connectionLabel(connectionId), lineSeparator)
+		writers := r.Graph.Writers[connectionId]
+		readers := r.Graph.Readers[connectionId]
+
+		if len(writers) == 0 {
+			writers = []string{externalVertexID(connectionId)}
+		}
+		if len(readers) == 0 {
+			readers = []string{externalVertexID(connectionId)}
+		}
+
+		for _, writerId := range writers {
+			for _, readerId := range readers {
+				edges = append(edges, graphEdge{From: writerId, To: readerId, Label: label})
+			}
+		}
+	}
+
+	return edges
+}
+
+// clusters groups vertex ids by deployment, in deployment id order.
+func clusters(vertices []graphVertex) (deploymentIds []string, members map[string][]string) {
+	members = map[string][]string{}
+	for _, vertex := range vertices {
+		if vertex.Deployment == "" {
+			continue
+		}
+		if _, ok := members[vertex.Deployment]; !ok {
+			deploymentIds = append(deploymentIds, vertex.Deployment)
+		}
+		members[vertex.Deployment] = append(members[vertex.Deployment], vertex.ID)
+	}
+	sort.Strings(deploymentIds)
+
+	return deploymentIds, members
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote quotes a DOT id, escaping backslashes and quotes and writing line
+// breaks as DOT's \n.
+func dotQuote(value string) string {
+	return `"` + dotEscaper.Replace(value) + `"`
+}
+
+func (r *GraphRenderer) RenderDOT() string {
+	vertices := r.vertices()
+	lines := []string{
+		fmt.Sprintf("digraph %s {", dotQuote(r.Topology.Name)),
+		"    rankdir=LR;",
+		"    node [shape=box];",
+	}
+
+	deploymentIds, members := clusters(vertices)
+	for _, deploymentID := range deploymentIds {
+		lines = append(lines, fmt.Sprintf("    subgraph %s {", dotQuote("cluster_"+deploymentID)))
+		lines = append(lines, fmt.Sprintf("        label=%s;", dotQuote(deploymentID)))
+		for _, vertexId := range members[deploymentID] {
+			lines = append(lines, fmt.Sprintf("        %s;", dotQuote(vertexId)))
+		}
+		lines = append(lines, "    }")
+	}
+
+	for _, vertex := range vertices {
+		if vertex.External {
+			lines = append(lines, fmt.Sprintf("    %s [label=%s, shape=ellipse, style=dashed];", dotQuote(vertex.ID), dotQuote(vertex.Label)))
+		}
+	}
+
+	for _, edge := range r.edges("\n") {
+		lines = append(lines, fmt.Sprintf("    %s -> %s [label=%s];", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Label)))
+	}
+
+	lines = append(lines, "}")
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// mermaidIDs maps every id to one mermaid accepts. Ids that come out the same,
+// such as a-b and a_b, are told apart by appending an index.
+func mermaidIDs(ids []string) map[string]string {
+	mermaidIds := map[string]string{}
+	taken := map[string]bool{}
+	for _, id := range ids {
+		if _, ok := mermaidIds[id]; ok {
+			continue
+		}
+
+		base := mermaidUnsafe.ReplaceAllString(id, "_")
+		mermaidId := base
+		for index := 2; taken[mermaidId]; index++ {
+			mermaidId = fmt.Sprintf("%s_%d", base, index)
+		}
+
+		mermaidIds[id] = mermaidId
+		taken[mermaidId] = true
+	}
+
+	return mermaidIds
+}
+
+func mermaidText(text string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(text)
+}
+
+func (r *GraphRenderer) RenderMermaid() string {
+	vertices := r.vertices()
+	lines := []string{"flowchart LR"}
+
+	deploymentIds, members := clusters(vertices)
+
+	ids := []string{}
+	for _, vertex := range vertices {
+		ids = append(ids, vertex.ID)
+	}
+	for _, deploymentID := range deploymentIds {
+		ids = append(ids, "cluster_"+deploymentID)
+	}
+	mermaidId := mermaidIDs(ids)
+
+	for _, deploymentID := range deploymentIds {
+		lines = append(lines, fmt.Sprintf(`    subgraph %s ["%s"]`, mermaidId["cluster_"+deploymentID], mermaidText(deploymentID)))
+		for _, vertexId := range members[deploymentID] {
+			lines = append(lines, fmt.Sprintf(`        %s["%s"]`, mermaidId[vertexId], mermaidText(vertexId)))
+		}
+		lines = append(lines, "    end")
+	}
+
+	for _, vertex := range vertices {
+		if vertex.Deployment != "" {
+			continue
+		}
+		if vertex.External {
+			lines = append(lines, fmt.Sprintf(`    %s(["%s"])`, mermaidId[vertex.ID], mermaidText(vertex.Label)))
+		} else {
+			lines = append(lines, fmt.Sprintf(`    %s["%s"]`, mermaidId[vertex.ID], mermaidText(vertex.Label)))
+		}
+	}
+
+	for _, edge := range r.edges("<br/>") {
+		lines = append(lines, fmt.Sprintf(`    %s -->|"%s"| %s`, mermaidId[edge.From], mermaidText(edge.Label), mermaidId[edge.To]))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// layers assigns every vertex a column by longest path from the sources.
+// Edges that close a cycle are ignored so that the layering terminates.
+func layers(vertices []graphVertex, edges []graphEdge) map[string]int {
+	successors := map[string][]string{}
+	for _, edge := range edges {
+		successors[edge.From] = append(successors[edge.From], edge.To)
+	}
+
+	// find back edges with a depth first search
+	backEdges := map[graphEdge]bool{}
+	state := map[string]int{}
+	var visit func(vertexId string)
+	visit = func(vertexId string) {
+		state[vertexId] = 1
+		for _, successorId := range successors[vertexId] {
+			switch state[successorId] {
+			case 0:
+				visit(successorId)
+			case 1:
+				backEdges[graphEdge{From: vertexId, To: successorId}] = true
+			}
+		}
+		state[vertexId] = 2
+	}
+	for _, vertex := range vertices {
+		if state[vertex.ID] == 0 {
+			visit(vertex.ID)
+		}
+	}
+
+	inDegree := map[string]int{}
+	for _, edge := range edges {
+		if !backEdges[graphEdge{From: edge.From, To: edge.To}] {
+			inDegree[edge.To]++
+		}
+	}
+
+	layer := map[string]int{}
+	pending := []string{}
+	for _, vertex := range vertices {
+		if inDegree[vertex.ID] == 0 {
+			pending = append(pending, vertex.ID)
+		}
+	}
+
+	for len(pending) > 0 {
+		vertexId := pending[0]
+		pending = pending[1:]
+
+		for _, successorId := range successors[vertexId] {
+			if backEdges[graphEdge{From: vertexId, To: successorId}] {
+				continue
+			}
+			if layer[vertexId]+1 > layer[successorId] {
+				layer[successorId] = layer[vertexId] + 1
+			}
+			inDegree[successorId]--
+			if inDegree[successorId] == 0 {
+				pending = append(pending, successorId)
+			}
+		}
+	}
+
+	return layer
+}
+
+const (
+	svgNodeWidth   = 160
+	svgNodeHeight  = 40
+	svgColumnGap   = 120
+	svgRowGap      = 50
+	svgMargin      = 40
+	svgClusterPad  = 14
+	svgLabelHeight = 14
+)
+
+type svgBox struct {
+	X, Y, Width, Height int
+}
+
+// RenderSVG lays the graph out in columns without any external tooling and
+// renders it as a standalone SVG document.
+func (r *GraphRenderer) RenderSVG() string {
+	vertices := r.vertices()
+	edges := r.edges("\n")
+	layer := layers(vertices, edges)
+
+	columns := map[int][]graphVertex{}
+	columnCount := 0
+	for _, vertex := range vertices {
+		column := layer[vertex.ID]
+		columns[column] = append(columns[column], vertex)
+		if column+1 > columnCount {
+			columnCount = column + 1
+		}
+	}
+
+	boxes := map[string]svgBox{}
+	rowCount := 0
+	for column := 0; column < columnCount; column++ {
+		members := columns[column]
+		// keep the nodes of a deployment next to one another so clusters stay compact
+		sort.SliceStable(members, func(i, j int) bool {
+			if members[i].Deployment != members[j].Deployment {
+				return members[i].Deployment < members[j].Deployment
+			}
+			return members[i].ID < members[j].ID
+		})
+
+		for row, vertex := range members {
+			boxes[vertex.ID] = svgBox{
+				X:      svgMargin + column*(svgNodeWidth+svgColumnGap),
+				Y:      svgMargin + row*(svgNodeHeight+svgRowGap),
+				Width:  svgNodeWidth,
+				Height: svgNodeHeight,
+			}
+		}
+		if len(members) > rowCount {
+			rowCount = len(members)
+		}
+	}
+
+	width := 2*svgMargin + columnCount*svgNodeWidth + (columnCount-1)*svgColumnGap
+	height := 2*svgMargin + rowCount*svgNodeHeight + (rowCount-1)*svgRowGap
+	if columnCount == 0 {
+		width, height = 2*svgMargin, 2*svgMargin
+	}
+
+	lines := []string{
+		fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`, width, height, width, height),
+		`  <defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z"/></marker></defs>`,
+		fmt.Sprintf(`  <title>%s</title>`, html.EscapeString(r.Topology.Name)),
+	}
+
+	deploymentIds, members := clusters(vertices)
+	for _, deploymentID := range deploymentIds {
+		var bounds svgBox
+		for idx, vertexId := range members[deploymentID] {
+			box := boxes[vertexId]
+			if idx == 0 {
+				bounds = box
+				continue
+			}
+			right, bottom := bounds.X+bounds.Width, bounds.Y+bounds.Height
+			if box.X < bounds.X {
+				bounds.X = box.X
+			}
+			if box.Y < bounds.Y {
+				bounds.Y = box.Y
+			}
+			if box.X+box.Width > right {
+				right = box.X + box.Width
+			}
+			if box.Y+box.Height > bottom {
+				bottom = box.Y + box.Height
+			}
+			bounds.Width, bounds.Height = right-bounds.X, bottom-bounds.Y
+		}
+
+		x, y := bounds.X-svgClusterPad, bounds.Y-svgClusterPad-svgLabelHeight
+		lines = append(lines, fmt.Sprintf(`  <rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="#f3f6fa" stroke="#8aa4c8" stroke-dasharray="4 2"/>`,
+			x, y, bounds.Width+2*svgClusterPad, bounds.Height+2*svgClusterPad+svgLabelHeight))
+		lines = append(lines, fmt.Sprintf(`  <text x="%d" y="%d" fill="#4a6285">%s</text>`, x+6, y+svgLabelHeight, html.EscapeString(deploymentID)))
+	}
+
+	for _, edge := range edges {
+		from, to := boxes[edge.From], boxes[edge.To]
+
+		if layer[edge.To] <= layer[edge.From] {
+			// feedback edges loop underneath the nodes they connect
+			bottom := from.Y + from.Height
+			if to.Y+to.Height > bottom {
+				bottom = to.Y + to.Height
+			}
+			x1, y1 := from.X+from.Width/2, from.Y+from.Height
+			x2, y2 := to.X+to.Width/2, to.Y+to.Height
+			lines = append(lines, fmt.Sprintf(`  <path d="M %d %d C %d %d %d %d %d %d" fill="none" stroke="#555" marker-end="url(#arrow)"/>`,
+				x1, y1, x1, bottom+svgRowGap, x2, bottom+svgRowGap, x2, y2))
+			lines = append(lines, svgEdgeLabel((x1+x2)/2, bottom+svgRowGap/2+svgLabelHeight, edge.Label)...)
+			continue
+		}
+
+		x1, y1 := from.X+from.Width, from.Y+from.Height/2
+		x2, y2 := to.X, to.Y+to.Height/2
+		lines = append(lines, fmt.Sprintf(`  <line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#555" marker-end="url(#arrow)"/>`, x1, y1, x2, y2))
+		lines = append(lines, svgEdgeLabel((x1+x2)/2, (y1+y2)/2-4, edge.Label)...)
+	}
+
+	for _, vertex := range vertices {
+		box := boxes[vertex.ID]
+		if vertex.External {
+			lines = append(lines, fmt.Sprintf(`  <rect x="%d" y="%d" width="%d" height="%d" rx="20" fill="#fff" stroke="#888" stroke-dasharray="4 2"/>`, box.X, box.Y, box.Width, box.Height))
+		} else {
+			lines = append(lines, fmt.Sprintf(`  <rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="#fff" stroke="#333"/>`, box.X, box.Y, box.Width, box.Height))
+		}
+		lines = append(lines, fmt.Sprintf(`  <text x="%d" y="%d" text-anchor="middle" dominant-baseline="middle">%s</text>`, box.X+box.Width/2, box.Y+box.Height/2, html.EscapeString(vertex.Label)))
+	}
+
+	lines = append(lines, "</svg>")
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func svgEdgeLabel(x int, y int, label string) (lines []string) {
+	labelLines := strings.Split(label, "\n")
+	y -= (len(labelLines) - 1) * svgLabelHeight
+	for idx, labelLine := range labelLines {
+		lines = append(lines, fmt.Sprintf(`  <text x="%d" y="%d" text-anchor="middle" font-size="10" fill="#555">%s</text>`, x, y+idx*svgLabelHeight, html.EscapeString(labelLine)))
+	}
+
+	return lines
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedTopologyDOT = `digraph "location-pipeline" {
+    rankdir=LR;
+    node [shape=box];
+    "connection:locations" [label="locations", shape=ellipse, style=dashed];
+    "predictArrivals" -> "notifyArrivals" [label="estimatedArrivals"];
+    "connection:locations" -> "predictArrivals" [label="locations"];
+    "connection:locations" -> "writeLocations" [label="locations"];
+}
+`
+
+const expectedEnvironmentMermaid = `flowchart LR
+    subgraph cluster_notify_arrivals ["notify-arrivals"]
+        notifyArrivals["notifyArrivals"]
+    end
+    subgraph cluster_predict_arrivals ["predict-arrivals"]
+        predictArrivals["predictArrivals"]
+    end
+    subgraph cluster_write_locations ["write-locations"]
+        writeLocations["writeLocations"]
+    end
+    connection_locations(["locations"])
+    predictArrivals -->|"estimatedArrivals<br/>platform: node.js<br/>topic: $ESTIMATED_ARRIVALS_TOPIC"| notifyArrivals
+    connection_locations -->|"locations<br/>platform: node.js<br/>topic: $LOCATIONS_TOPIC"| predictArrivals
+    connection_locations -->|"locations<br/>platform: node.js<br/>topic: $LOCATIONS_TOPIC"| writeLocations
+`
+
+func TestRenderDOT(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	_, err := builder.LoadTopology()
+	if err != nil {
+		t.Errorf("LoadTopology did not complete successfully: %s", err)
+	}
+
+	dot := NewGraphRenderer(builder.Topology, nil).RenderDOT()
+	if dot != expectedTopologyDOT {
+		t.Errorf("DOT did not match:-->%s<-- vs. -->%s<--", dot, expectedTopologyDOT)
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	mermaid := NewGraphRenderer(builder.Topology, &builder.Environment).RenderMermaid()
+	if mermaid != expectedEnvironmentMermaid {
+		t.Errorf("Mermaid did not match:-->%s<-- vs. -->%s<--", mermaid, expectedEnvironmentMermaid)
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	quoted := dotQuote("C:\\topics\\\"arrivals\"\nplatform: node.js")
+	expectedQuoted := `"C:\\topics\\\"arrivals\"\nplatform: node.js"`
+	if quoted != expectedQuoted {
+		t.Errorf("quoted id did not match:-->%s<-- vs. -->%s<--", quoted, expectedQuoted)
+	}
+}
+
+func TestMermaidIDs(t *testing.T) {
+	mermaidIds := mermaidIDs([]string{"a-b", "a_b", "a.b", "a-b", "connection:a"})
+	expectedIds := map[string]string{
+		"a-b":          "a_b",
+		"a_b":          "a_b_2",
+		"a.b":          "a_b_3",
+		"connection:a": "connection_a",
+	}
+
+	if len(mermaidIds) != len(expectedIds) {
+		t.Errorf("expected %d ids, got: %v", len(expectedIds), mermaidIds)
+	}
+	for id, expectedId := range expectedIds {
+		if mermaidIds[id] != expectedId {
+			t.Errorf("mermaid id of %s did not match:-->%s<-- vs. -->%s<--", id, mermaidIds[id], expectedId)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	builder := NewBuilder("fixtures/cyclic-topology.json", "fixtures/environment.json")
+	_, err := builder.LoadTopology()
+	if err != nil {
+		t.Errorf("LoadTopology did not complete successfully: %s", err)
+	}
+
+	svg := NewGraphRenderer(builder.Topology, nil).RenderSVG()
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("SVG is not a standalone document: %s", svg)
+	}
+
+	for _, nodeId := range []string{"ingest", "refine", "correct", "echoA", "echoB"} {
+		if !strings.Contains(svg, ">"+nodeId+"</text>") {
+			t.Errorf("SVG does not draw node %s", nodeId)
+		}
+	}
+}
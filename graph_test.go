@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphAnalysis(t *testing.T) {
+	builder := NewBuilder("fixtures/cyclic-topology.json", "fixtures/environment.json")
+	topology, err := builder.LoadTopology()
+	if err != nil {
+		t.Errorf("LoadTopology did not complete successfully: %s", err)
+	}
+
+	graph := NewGraph(*topology)
+
+	expectedCycles := [][]string{{"correct", "refine"}, {"echoA", "echoB"}}
+	if cycles := graph.Cycles(); !reflect.DeepEqual(cycles, expectedCycles) {
+		t.Errorf("cycles did not match: %v vs. %v", cycles, expectedCycles)
+	}
+
+	if unread := graph.UnreadConnections(); !reflect.DeepEqual(unread, []string{"audit"}) {
+		t.Errorf("unread connections did not match: %v", unread)
+	}
+
+	if unwritten := graph.UnwrittenConnections(); !reflect.DeepEqual(unwritten, []string{"raw"}) {
+		t.Errorf("unwritten connections did not match: %v", unwritten)
+	}
+
+	if unreachable := graph.Unreachable(); !reflect.DeepEqual(unreachable, []string{"echoA", "echoB"}) {
+		t.Errorf("unreachable nodes did not match: %v", unreachable)
+	}
+}
+
+func TestValidateCycles(t *testing.T) {
+	builder := NewBuilder("fixtures/cyclic-topology.json", "fixtures/environment.json")
+	_, err := builder.LoadTopology()
+	if err != nil {
+		t.Errorf("LoadTopology did not complete successfully: %s", err)
+	}
+
+	validator := NewValidator(builder.Topology, builder.Environment)
+	validator.TopologySource = builder.TopologySource
+
+	cycleSeverities := map[string]Severity{}
+	for _, diagnostic := range validator.checkGraph() {
+		if diagnostic.Code == CodeCycle {
+			cycleSeverities[diagnostic.Path] = diagnostic.Severity
+		}
+	}
+
+	if severity, ok := cycleSeverities["nodes.correct"]; !ok || severity != SeverityError {
+		t.Errorf("expected cycle error for correct/refine, got: %v", cycleSeverities)
+	}
+
+	if severity, ok := cycleSeverities["nodes.echoA"]; !ok || severity != SeverityWarning {
+		t.Errorf("expected allowed cycle warning for echoA/echoB, got: %v", cycleSeverities)
+	}
+}
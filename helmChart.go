@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const chartYamlTemplate = `apiVersion: v1
+name: %s
+description: %s stage of the %s topology
+version: 1.0.0
+appVersion: "1.0.0"
+`
+
+const deploymentYamlTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Values.serviceName }}
+  namespace: {{ .Values.serviceNamespace }}
+  labels:
+    app: {{ .Values.serviceName }}
+spec:
+  replicas: {{ .Values.replicas }}
+  selector:
+    matchLabels:
+      app: {{ .Values.serviceName }}
+  template:
+    metadata:
+      labels:
+        app: {{ .Values.serviceName }}
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "{{ .Values.servicePort }}"
+    spec:
+      containers:
+        - name: {{ .Values.serviceName }}
+          image: {{ .Values.image }}
+          imagePullPolicy: {{ .Values.imagePullPolicy }}
+          ports:
+            - containerPort: {{ .Values.servicePort }}
+          env:
+            - name: LOG_SEVERITY
+              value: {{ .Values.logSeverity | quote }}
+%s
+          resources:
+            requests:
+              cpu: {{ .Values.cpuRequest }}
+              memory: {{ .Values.memoryRequest }}
+            limits:
+              cpu: {{ .Values.cpuLimit }}
+              memory: {{ .Values.memoryLimit }}
+{{- if .Values.imagePullSecrets }}
+      imagePullSecrets:
+        - name: {{ .Values.imagePullSecrets }}
+{{- end }}
+`
+
+const serviceYamlTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Values.serviceName }}
+  namespace: {{ .Values.serviceNamespace }}
+  labels:
+    app: {{ .Values.serviceName }}
+spec:
+  selector:
+    app: {{ .Values.serviceName }}
+  ports:
+    - name: http
+      port: {{ .Values.servicePort }}
+      targetPort: {{ .Values.servicePort }}
+`
+
+const startStageChartTemplate = `#!/bin/bash
+
+# installs or upgrades the chart of this stage, e.g.
+#   IMAGE=%s:latest ./devops/start-stage
+
+cd "$(dirname "$0")"
+
+helm upgrade --install %s . \
+    --namespace %s \
+    --set image=$IMAGE
+`
+
+const deployStageTemplate = `#!/bin/bash
+
+set -e
+
+cd "$(dirname "$0")"
+
+IMAGE_TAG=${IMAGE_TAG:-$(date +%%Y%%m%%d%%H%%M%%S)}
+export IMAGE=%s:$IMAGE_TAG
+
+docker build -t $IMAGE .
+docker push $IMAGE
+
+./devops/start-stage
+`
+
+// FillValuesYAML renders the values of a deployment's Helm chart from its
+// resources, replicas and log severity and the environment's namespace and
+// pull secret. The image is passed in by start-stage once it has been pushed.
+func (b *Builder) FillValuesYAML(deploymentID string) (valuesYaml string) {
+	stage := b.ResolveKubernetesStage(deploymentID)
+
+	return fmt.Sprintf(`cpuRequest: '%s'
+cpuLimit: '%s'
+imagePullPolicy: 'Always'
+imagePullSecrets: %s
+logSeverity: '%s'
+memoryRequest: '%s'
+memoryLimit: '%s'
+replicas: %d
+serviceName: '%s'
+serviceNamespace: '%s'
+servicePort: %d`,
+		stage.CPURequest,
+		stage.CPULimit,
+		stage.ImagePullSecret,
+		stage.LogSeverity,
+		stage.MemoryRequest,
+		stage.MemoryLimit,
+		stage.Replicas,
+		stage.Name,
+		stage.Namespace,
+		stage.Port)
+}
+
+// FillChartEnv renders the env entries of the chart's container.
+func (b *Builder) FillChartEnv(deploymentID string) (env string) {
+	return fillSecretEnv(b.ResolveKubernetesStage(deploymentID), "            ")
+}
+
+func (b *Builder) FillDeploymentYAML(deploymentID string) (deploymentYaml string) {
+	return fmt.Sprintf(deploymentYamlTemplate, b.FillChartEnv(deploymentID))
+}
+
+// BuildChart writes the Helm chart of a deployment to its devops directory
+// and a deploy-stage script that builds and pushes its image and installs the
+// chart.
+func (b *Builder) BuildChart(deploymentID string) (err error) {
+	devopsPath := path.Join(b.DeploymentPath, "devops")
+	templatesPath := path.Join(devopsPath, "templates")
+	if err = os.MkdirAll(templatesPath, 0755); err != nil {
+		return err
+	}
+
+	chartYaml := fmt.Sprintf(chartYamlTemplate, deploymentID, deploymentID, b.Topology.Name)
+	if err = ioutil.WriteFile(path.Join(devopsPath, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(devopsPath, "values.yaml"), []byte(b.FillValuesYAML(deploymentID)+"\n"), 0644); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(templatesPath, "deployment.yaml"), []byte(b.FillDeploymentYAML(deploymentID)), 0644); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(templatesPath, "service.yaml"), []byte(serviceYamlTemplate), 0644); err != nil {
+		return err
+	}
+
+	stage := b.ResolveKubernetesStage(deploymentID)
+
+	for fileName, manifest := range autoscalingManifests(stage) {
+		if err = ioutil.WriteFile(path.Join(templatesPath, fileName), []byte(manifest), 0644); err != nil {
+			return err
+		}
+	}
+
+	startStage := fmt.Sprintf(startStageChartTemplate, stage.Image, stage.Name, stage.Namespace)
+	if err = ioutil.WriteFile(path.Join(devopsPath, "start-stage"), []byte(startStage), 0755); err != nil {
+		return err
+	}
+
+	deployStage := fmt.Sprintf(deployStageTemplate, stage.Image)
+	return ioutil.WriteFile(path.Join(b.DeploymentPath, "deploy-stage"), []byte(deployStage), 0755)
+}
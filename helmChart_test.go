@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedWriteLocationsChartEnv = `            - name: CASSANDRA_ENDPOINT
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "CASSANDRA_ENDPOINT"
+            - name: KAFKA_ENDPOINT
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "KAFKA_ENDPOINT"
+            - name: LOCATIONS_KEYFIELD
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "LOCATIONS_KEYFIELD"
+            - name: LOCATIONS_TOPIC
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "LOCATIONS_TOPIC"`
+
+func TestFillChartEnv(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	chartEnv := builder.FillChartEnv("write-locations")
+	if chartEnv != expectedWriteLocationsChartEnv {
+		t.Errorf("chart env did not match:-->%s<-- vs. -->%s<--", chartEnv, expectedWriteLocationsChartEnv)
+	}
+}
+
+func TestFillChartEnvReadsSecrets(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	builder.Environment.Processors["writeLocations"] = ProcessorEnv{
+		Config: map[string]interface{}{
+			"password":  map[string]interface{}{"secret": "cassandra/password"},
+			"batchSize": map[string]interface{}{"env": "BATCH_SIZE", "default": 100},
+		},
+	}
+
+	expectedEntries := []string{
+		`            - name: BATCH_SIZE
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "BATCH_SIZE"
+                  optional: true`,
+		`            - name: CASSANDRA_PASSWORD
+              valueFrom:
+                secretKeyRef:
+                  name: "cassandra"
+                  key: "password"`,
+	}
+
+	chartEnv := builder.FillChartEnv("write-locations")
+	for _, expectedEntry := range expectedEntries {
+		if !strings.Contains(chartEnv, expectedEntry) {
+			t.Errorf("chart env did not contain:-->%s<-- in -->%s<--", expectedEntry, chartEnv)
+		}
+	}
+}
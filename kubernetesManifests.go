@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const manifestDeploymentTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+  labels:
+    app: %[1]s
+spec:
+  replicas: %[3]d
+  selector:
+    matchLabels:
+      app: %[1]s
+  template:
+    metadata:
+      labels:
+        app: %[1]s
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "%[4]d"
+    spec:
+      containers:
+        - name: %[1]s
+          image: %[5]s
+          imagePullPolicy: Always
+          ports:
+            - containerPort: %[4]d
+          envFrom:
+            - configMapRef:
+                name: %[6]s
+          env:
+%[7]s
+          resources:
+            requests:
+              cpu: %[8]s
+              memory: %[9]s
+            limits:
+              cpu: %[10]s
+              memory: %[11]s
+%[12]s`
+
+const manifestServiceTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+  labels:
+    app: %[1]s
+spec:
+  selector:
+    app: %[1]s
+  ports:
+    - name: http
+      port: %[3]d
+      targetPort: %[3]d
+`
+
+const manifestConfigMapTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+  namespace: %s
+data:
+  LOG_SEVERITY: %s
+`
+
+// plainEnv lists the environment variables of a stage that are not read
+// from a Secret named in the config, and so live in its <deployment>-env
+// Secret.
+func plainEnv(stage KubernetesStage) (requirements []EnvRequirement) {
+	for _, requirement := range stage.Env {
+		if !requirement.IsSecret() {
+			requirements = append(requirements, requirement)
+		}
+	}
+
+	return requirements
+}
+
+// namedSecretEnv lists the environment variables of a stage that are read
+// from Secrets named in the config.
+func namedSecretEnv(stage KubernetesStage) (requirements []EnvRequirement) {
+	for _, requirement := range stage.Env {
+		if requirement.IsSecret() {
+			requirements = append(requirements, requirement)
+		}
+	}
+
+	return requirements
+}
+
+// FillManifestKustomization lists the manifests of a stage and generates
+// its <deployment>-env Secret from secret.env, which deploy-stage writes
+// from the variables set where it runs. The Secrets named by secret-typed
+// config may be shared by stages, so the generated secret.yaml is only a
+// skeleton of them to fill in and apply once.
+func FillManifestKustomization(stage KubernetesStage, manifestFileNames []string) string {
+	resources := []string{}
+	for _, fileName := range manifestFileNames {
+		resources = append(resources, fmt.Sprintf("  - %s", fileName))
+	}
+
+	header := ""
+	if len(namedSecretEnv(stage)) > 0 {
+		header = `# secret.yaml is a skeleton of the Secrets this stage reads: fill it in and
+# apply it separately with kubectl apply -f secret.yaml.
+`
+	}
+
+	secretGenerator := ""
+	if len(plainEnv(stage)) > 0 {
+		secretGenerator = fmt.Sprintf(`secretGenerator:
+  - name: %s
+    namespace: %s
+    envs:
+      - secret.env
+`, deploymentSecretName(stage.Name), stage.Namespace)
+	}
+
+	return fmt.Sprintf(`%sapiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+%s
+%s`, header, strings.Join(resources, "\n"), secretGenerator)
+}
+
+// FillManifestSecretEnv renders the secret.env of a stage before it is
+// deployed, with every variable commented out, as an empty value would
+// hide the defaults of optional variables.
+func FillManifestSecretEnv(stage KubernetesStage) string {
+	lines := []string{
+		fmt.Sprintf("# values of Secret %s, which deploy-stage writes from the variables set", deploymentSecretName(stage.Name)),
+		"# where it runs. Uncomment and set them to apply the manifests directly.",
+	}
+
+	for _, requirement := range plainEnv(stage) {
+		lines = append(lines, "")
+		for _, usage := range requirement.UsedBy {
+			lines = append(lines, fmt.Sprintf("# %s", usage))
+		}
+		if requirement.HasDefault {
+			lines = append(lines, fmt.Sprintf("# optional, defaults to %s", jsonLiteral(requirement.Default)))
+		}
+		lines = append(lines, fmt.Sprintf("#%s=", requirement.Name))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// deployStageManifestsTemplate writes secret.env from the environment,
+// failing when a required variable is not set, and pins the image of the
+// stage to the tag it pushes before applying the manifests.
+const deployStageManifestsTemplate = `#!/bin/bash
+
+set -e
+
+cd "$(dirname "$0")"
+
+required_env="%[2]s"
+optional_env="%[3]s"
+
+for name in $required_env; do
+    if [ -z "${!name+x}" ]; then
+        echo "missing environment variable $name" >&2
+        exit 1
+    fi
+done
+
+IMAGE_TAG=${IMAGE_TAG:-$(date +%%Y%%m%%d%%H%%M%%S)}
+IMAGE=%[1]s:$IMAGE_TAG
+
+docker build -t $IMAGE .
+docker push $IMAGE
+
+: > devops/secret.env
+for name in $required_env $optional_env; do
+    if [ -n "${!name+x}" ]; then
+        echo "$name=${!name}" >> devops/secret.env
+    fi
+done
+
+(cd devops && kustomize edit set image %[1]s=$IMAGE)
+kubectl apply -k devops
+`
+
+// FillDeployStageManifests renders the deploy-stage script of a stage.
+func FillDeployStageManifests(stage KubernetesStage) string {
+	required, optional := []string{}, []string{}
+	for _, requirement := range plainEnv(stage) {
+		if requirement.HasDefault {
+			optional = append(optional, requirement.Name)
+		} else {
+			required = append(required, requirement.Name)
+		}
+	}
+
+	return fmt.Sprintf(deployStageManifestsTemplate, stage.Image, strings.Join(required, " "), strings.Join(optional, " "))
+}
+
+func configMapName(deploymentID string) string {
+	return deploymentID + "-config"
+}
+
+func FillManifestDeployment(stage KubernetesStage) string {
+	env := fillSecretEnv(stage, "            ")
+	if env == "" {
+		env = "            []"
+	}
+
+	imagePullSecrets := ""
+	if stage.ImagePullSecret != "" {
+		imagePullSecrets = fmt.Sprintf("      imagePullSecrets:\n        - name: %s\n", jsonLiteral(stage.ImagePullSecret))
+	}
+
+	return fmt.Sprintf(manifestDeploymentTemplate,
+		stage.Name,
+		stage.Namespace,
+		stage.Replicas,
+		stage.Port,
+		stage.Image,
+		configMapName(stage.Name),
+		env,
+		stage.CPURequest,
+		stage.MemoryRequest,
+		stage.CPULimit,
+		stage.MemoryLimit,
+		imagePullSecrets)
+}
+
+func FillManifestService(stage KubernetesStage) string {
+	return fmt.Sprintf(manifestServiceTemplate, stage.Name, stage.Namespace, stage.Port)
+}
+
+func FillManifestConfigMap(stage KubernetesStage) string {
+	return fmt.Sprintf(manifestConfigMapTemplate, configMapName(stage.Name), stage.Namespace, jsonLiteral(stage.LogSeverity))
+}
+
+// FillTierKustomization lists the manifests of every deployment of a tier so
+// that kubectl apply -k build/<tier> deploys the whole topology.
+func FillTierKustomization(deploymentIDs []string) string {
+	resources := []string{}
+	for _, deploymentID := range deploymentIDs {
+		resources = append(resources, fmt.Sprintf("  - %s/devops", deploymentID))
+	}
+
+	return fmt.Sprintf(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+%s
+`, strings.Join(resources, "\n"))
+}
+
+// BuildManifests writes plain Kubernetes manifests of a deployment to its
+// devops directory and a deploy-stage script that builds and pushes its image,
+// generates its Secret and applies them.
+func (b *Builder) BuildManifests(deploymentID string) (err error) {
+	stage := b.ResolveKubernetesStage(deploymentID)
+
+	devopsPath := path.Join(b.DeploymentPath, "devops")
+	if err = os.MkdirAll(devopsPath, 0755); err != nil {
+		return err
+	}
+
+	manifests := map[string]string{
+		"configmap.yaml":  FillManifestConfigMap(stage),
+		"deployment.yaml": FillManifestDeployment(stage),
+		"service.yaml":    FillManifestService(stage),
+	}
+	for fileName, manifest := range autoscalingManifests(stage) {
+		manifests[fileName] = manifest
+	}
+
+	fileNames := []string{}
+	for fileName := range manifests {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	manifests["kustomization.yaml"] = FillManifestKustomization(stage, fileNames)
+	if len(plainEnv(stage)) > 0 {
+		manifests["secret.env"] = FillManifestSecretEnv(stage)
+	}
+	if namedSecrets := namedSecretEnv(stage); len(namedSecrets) > 0 {
+		manifests["secret.yaml"] = FillSecretSkeleton(deploymentID, stage.Namespace, namedSecrets)
+	}
+
+	for fileName, manifest := range manifests {
+		if err = ioutil.WriteFile(path.Join(devopsPath, fileName), []byte(manifest), 0644); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(path.Join(b.DeploymentPath, "deploy-stage"), []byte(FillDeployStageManifests(stage)), 0755)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const expectedWriteLocationsManifestDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: write-locations
+  namespace: data-pipeline
+  labels:
+    app: write-locations
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: write-locations
+  template:
+    metadata:
+      labels:
+        app: write-locations
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "80"
+    spec:
+      containers:
+        - name: write-locations
+          image: tpark.azurecr.io/tpark/write-locations
+          imagePullPolicy: Always
+          ports:
+            - containerPort: 80
+          envFrom:
+            - configMapRef:
+                name: write-locations-config
+          env:
+            - name: CASSANDRA_ENDPOINT
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "CASSANDRA_ENDPOINT"
+            - name: KAFKA_ENDPOINT
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "KAFKA_ENDPOINT"
+            - name: LOCATIONS_KEYFIELD
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "LOCATIONS_KEYFIELD"
+            - name: LOCATIONS_TOPIC
+              valueFrom:
+                secretKeyRef:
+                  name: "write-locations-env"
+                  key: "LOCATIONS_TOPIC"
+          resources:
+            requests:
+              cpu: 250m
+              memory: 256Mi
+            limits:
+              cpu: 1000m
+              memory: 512Mi
+      imagePullSecrets:
+        - name: "acr-tpark"
+`
+
+const expectedTierKustomization = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - notify-arrivals/devops
+  - predict-arrivals/devops
+  - write-locations/devops
+`
+
+const expectedWriteLocationsManifestKustomization = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - configmap.yaml
+  - deployment.yaml
+  - service.yaml
+secretGenerator:
+  - name: write-locations-env
+    namespace: data-pipeline
+    envs:
+      - secret.env
+`
+
+func TestFillManifestKustomization(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	stage := builder.ResolveKubernetesStage("write-locations")
+	kustomization := FillManifestKustomization(stage, []string{"configmap.yaml", "deployment.yaml", "service.yaml"})
+	if kustomization != expectedWriteLocationsManifestKustomization {
+		t.Errorf("kustomization.yaml did not match:-->%s<-- vs. -->%s<--", kustomization, expectedWriteLocationsManifestKustomization)
+	}
+
+	deployStage := FillDeployStageManifests(stage)
+	for _, expected := range []string{
+		`required_env="CASSANDRA_ENDPOINT KAFKA_ENDPOINT LOCATIONS_KEYFIELD LOCATIONS_TOPIC"`,
+		"(cd devops && kustomize edit set image tpark.azurecr.io/tpark/write-locations=$IMAGE)\nkubectl apply -k devops\n",
+	} {
+		if !strings.Contains(deployStage, expected) {
+			t.Errorf("deploy-stage did not contain -->%s<--: %s", expected, deployStage)
+		}
+	}
+	if strings.Contains(deployStage, "kubectl set image") {
+		t.Errorf("deploy-stage should pin the image with kustomize instead of rolling out twice: %s", deployStage)
+	}
+}
+
+func TestFillManifestDeployment(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	deploymentYaml := FillManifestDeployment(builder.ResolveKubernetesStage("write-locations"))
+	if deploymentYaml != expectedWriteLocationsManifestDeployment {
+		t.Errorf("deployment.yaml did not match:-->%s<-- vs. -->%s<--", deploymentYaml, expectedWriteLocationsManifestDeployment)
+	}
+}
+
+func TestBuildManifests(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/manifests.yaml")
+
+	err := builder.Build()
+	if err != nil {
+		t.Errorf("Build did not complete successfully: %s", err)
+	}
+
+	expectedItems := []string{
+		"build/manifests/kustomization.yaml",
+		"build/manifests/predict-arrivals/deploy-stage",
+		"build/manifests/predict-arrivals/devops/kustomization.yaml",
+		"build/manifests/predict-arrivals/devops/configmap.yaml",
+		"build/manifests/predict-arrivals/devops/deployment.yaml",
+		"build/manifests/predict-arrivals/devops/secret.env",
+		"build/manifests/predict-arrivals/devops/service.yaml",
+	}
+
+	for _, item := range expectedItems {
+		if _, err := os.Stat(item); os.IsNotExist(err) {
+			t.Errorf("Build did not create expected file: %s", item)
+		}
+	}
+
+	if _, err := os.Stat("build/manifests/predict-arrivals/devops/Chart.yaml"); err == nil {
+		t.Errorf("Build should not create a chart for the kubernetes-manifests target")
+	}
+
+	kustomization := FillTierKustomization(sortedDeploymentIds(builder.Environment.Deployments))
+	if kustomization != expectedTierKustomization {
+		t.Errorf("kustomization.yaml did not match:-->%s<-- vs. -->%s<--", kustomization, expectedTierKustomization)
+	}
+}
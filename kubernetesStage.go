@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const servicePort = 80
+
+// KubernetesStage is everything the Kubernetes targets need to know to run
+// one deployment, resolved from the topology and environment.
+type KubernetesStage struct {
+	Name            string
+	Namespace       string
+	Image           string
+	ImageTag        string
+	ImagePullSecret string
+	LogSeverity     string
+	CPURequest      string
+	CPULimit        string
+	MemoryRequest   string
+	MemoryLimit     string
+	Replicas        int32
+	MaxReplicas     int32
+	LagThreshold    int64
+	Port            int
+	Env             []EnvRequirement
+	KafkaTriggers   []KafkaTrigger
+}
+
+func (b *Builder) ResolveKubernetesStage(deploymentID string) KubernetesStage {
+	deployment := b.Environment.Deployments[deploymentID]
+
+	return KubernetesStage{
+		Name:            deploymentID,
+		Namespace:       b.Environment.Namespace,
+		Image:           fmt.Sprintf("%s/%s", b.Environment.ContainerRepo, deploymentID),
+		ImageTag:        b.Environment.ImageTag,
+		ImagePullSecret: b.Environment.PullSecret,
+		LogSeverity:     deployment.LogSeverity,
+		CPURequest:      deployment.CPU.Request,
+		CPULimit:        deployment.CPU.Limit,
+		MemoryRequest:   deployment.Memory.Request,
+		MemoryLimit:     deployment.Memory.Limit,
+		Replicas:        deployment.Replicas.Min,
+		MaxReplicas:     deployment.Replicas.Max,
+		LagThreshold:    deployment.Replicas.LagThreshold,
+		Port:            servicePort,
+		Env:             collectEnvRequirements(deployment, b.Topology, b.Environment),
+		KafkaTriggers:   kafkaTriggers(deploymentID, deployment, b.Topology, b.Environment),
+	}
+}
+
+// fillSecretEnv renders the container env entries of a stage, each read from
+// the Secret that FillSecretSkeleton generates for it. Variables with a
+// default are optional, so the stage falls back to the default when unset.
+func fillSecretEnv(stage KubernetesStage, indent string) string {
+	entries := []string{}
+	for _, requirement := range stage.Env {
+		secretName := deploymentSecretName(stage.Name)
+		secretKey := requirement.Name
+		if requirement.IsSecret() {
+			secretName = requirement.SecretName
+			secretKey = requirement.SecretKey
+		}
+
+		entry := []string{
+			fmt.Sprintf("- name: %s", requirement.Name),
+			"  valueFrom:",
+			"    secretKeyRef:",
+			fmt.Sprintf("      name: %s", jsonLiteral(secretName)),
+			fmt.Sprintf("      key: %s", jsonLiteral(secretKey)),
+		}
+		if requirement.HasDefault {
+			entry = append(entry, "      optional: true")
+		}
+
+		for _, line := range entry {
+			entries = append(entries, indent+line)
+		}
+	}
+
+	return strings.Join(entries, "\n")
+}
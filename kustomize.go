@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The settings of a stage that may differ between tiers. A setting that every
+// tier agrees on goes into the base, any other is patched by each overlay.
+const (
+	settingReplicas        = "replicas"
+	settingCPURequest      = "cpu.request"
+	settingCPULimit        = "cpu.limit"
+	settingMemoryRequest   = "memory.request"
+	settingMemoryLimit     = "memory.limit"
+	settingImagePullSecret = "imagePullSecret"
+	settingLogSeverity     = "logSeverity"
+)
+
+func stageSettings(stage KubernetesStage) map[string]string {
+	settings := map[string]string{
+		settingReplicas:        strconv.Itoa(int(stage.Replicas)),
+		settingCPURequest:      stage.CPURequest,
+		settingCPULimit:        stage.CPULimit,
+		settingMemoryRequest:   stage.MemoryRequest,
+		settingMemoryLimit:     stage.MemoryLimit,
+		settingImagePullSecret: stage.ImagePullSecret,
+		settingLogSeverity:     stage.LogSeverity,
+	}
+
+	for setting, value := range settings {
+		if value == "" {
+			delete(settings, setting)
+		}
+	}
+
+	return settings
+}
+
+type manifestMetadata struct {
+	Name        string            `yaml:"name,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type manifestSecretKeyRef struct {
+	Name     string `yaml:"name"`
+	Key      string `yaml:"key"`
+	Optional bool   `yaml:"optional,omitempty"`
+}
+
+type manifestEnvSource struct {
+	SecretKeyRef manifestSecretKeyRef `yaml:"secretKeyRef"`
+}
+
+type manifestEnvVar struct {
+	Name      string            `yaml:"name"`
+	ValueFrom manifestEnvSource `yaml:"valueFrom"`
+}
+
+type manifestConfigMapRef struct {
+	ConfigMapRef manifestName `yaml:"configMapRef"`
+}
+
+type manifestName struct {
+	Name string `yaml:"name"`
+}
+
+type manifestPort struct {
+	ContainerPort int `yaml:"containerPort"`
+}
+
+type manifestResources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+type manifestContainer struct {
+	Name            string                 `yaml:"name"`
+	Image           string                 `yaml:"image,omitempty"`
+	ImagePullPolicy string                 `yaml:"imagePullPolicy,omitempty"`
+	Ports           []manifestPort         `yaml:"ports,omitempty"`
+	EnvFrom         []manifestConfigMapRef `yaml:"envFrom,omitempty"`
+	Env             []manifestEnvVar       `yaml:"env,omitempty"`
+	Resources       *manifestResources     `yaml:"resources,omitempty"`
+}
+
+type manifestPodSpec struct {
+	Containers       []manifestContainer `yaml:"containers"`
+	ImagePullSecrets []manifestName      `yaml:"imagePullSecrets,omitempty"`
+}
+
+type manifestPodTemplate struct {
+	Metadata *manifestMetadata `yaml:"metadata,omitempty"`
+	Spec     manifestPodSpec   `yaml:"spec"`
+}
+
+type manifestSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type manifestDeploymentSpec struct {
+	Replicas *int                 `yaml:"replicas,omitempty"`
+	Selector *manifestSelector    `yaml:"selector,omitempty"`
+	Template *manifestPodTemplate `yaml:"template,omitempty"`
+}
+
+type manifestDeployment struct {
+	APIVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   manifestMetadata       `yaml:"metadata"`
+	Spec       manifestDeploymentSpec `yaml:"spec"`
+}
+
+type manifestConfigMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   manifestMetadata  `yaml:"metadata"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type manifestServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+}
+
+type manifestServiceSpec struct {
+	Selector map[string]string     `yaml:"selector"`
+	Ports    []manifestServicePort `yaml:"ports"`
+}
+
+type manifestService struct {
+	APIVersion string              `yaml:"apiVersion"`
+	Kind       string              `yaml:"kind"`
+	Metadata   manifestMetadata    `yaml:"metadata"`
+	Spec       manifestServiceSpec `yaml:"spec"`
+}
+
+func manifestEnv(stage KubernetesStage, requirement EnvRequirement) manifestEnvVar {
+	envVar := manifestEnvVar{Name: requirement.Name}
+	envVar.ValueFrom.SecretKeyRef = manifestSecretKeyRef{
+		Name:     deploymentSecretName(stage.Name),
+		Key:      requirement.Name,
+		Optional: requirement.HasDefault,
+	}
+	if requirement.IsSecret() {
+		envVar.ValueFrom.SecretKeyRef.Name = requirement.SecretName
+		envVar.ValueFrom.SecretKeyRef.Key = requirement.SecretKey
+	}
+
+	return envVar
+}
+
+// kustomizeDeployment renders the Deployment of a stage with only the given
+// settings and env. The base carries the full skeleton, while a patch only
+// names the deployment and container it changes.
+func kustomizeDeployment(stage KubernetesStage, settings map[string]string, env []manifestEnvVar, base bool) manifestDeployment {
+	labels := map[string]string{"app": stage.Name}
+
+	container := manifestContainer{Name: stage.Name, Env: env}
+
+	requests := map[string]string{}
+	limits := map[string]string{}
+	if cpuRequest, ok := settings[settingCPURequest]; ok {
+		requests["cpu"] = cpuRequest
+	}
+	if memoryRequest, ok := settings[settingMemoryRequest]; ok {
+		requests["memory"] = memoryRequest
+	}
+	if cpuLimit, ok := settings[settingCPULimit]; ok {
+		limits["cpu"] = cpuLimit
+	}
+	if memoryLimit, ok := settings[settingMemoryLimit]; ok {
+		limits["memory"] = memoryLimit
+	}
+	if len(requests) > 0 || len(limits) > 0 {
+		container.Resources = &manifestResources{Requests: requests, Limits: limits}
+	}
+
+	podSpec := manifestPodSpec{Containers: []manifestContainer{container}}
+	if pullSecret, ok := settings[settingImagePullSecret]; ok {
+		podSpec.ImagePullSecrets = []manifestName{{Name: pullSecret}}
+	}
+
+	deployment := manifestDeployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   manifestMetadata{Name: stage.Name},
+	}
+
+	if replicas, ok := settings[settingReplicas]; ok {
+		count, _ := strconv.Atoi(replicas)
+		deployment.Spec.Replicas = &count
+	}
+
+	if base {
+		deployment.Metadata.Labels = labels
+		deployment.Spec.Selector = &manifestSelector{MatchLabels: labels}
+
+		podSpec.Containers[0].Image = stage.Name
+		podSpec.Containers[0].ImagePullPolicy = "Always"
+		podSpec.Containers[0].Ports = []manifestPort{{ContainerPort: stage.Port}}
+		podSpec.Containers[0].EnvFrom = []manifestConfigMapRef{{ConfigMapRef: manifestName{Name: configMapName(stage.Name)}}}
+
+		deployment.Spec.Template = &manifestPodTemplate{
+			Metadata: &manifestMetadata{
+				Labels: labels,
+				Annotations: map[string]string{
+					"prometheus.io/scrape": "true",
+					"prometheus.io/port":   strconv.Itoa(stage.Port),
+				},
+			},
+			Spec: podSpec,
+		}
+	} else if len(container.Env) > 0 || container.Resources != nil || len(podSpec.ImagePullSecrets) > 0 {
+		deployment.Spec.Template = &manifestPodTemplate{Spec: podSpec}
+	}
+
+	return deployment
+}
+
+// kustomizeService renders the Service of a stage, which is the same in every
+// tier apart from the namespace the overlays place it in.
+func kustomizeService(stage KubernetesStage) manifestService {
+	labels := map[string]string{"app": stage.Name}
+
+	return manifestService{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Metadata:   manifestMetadata{Name: stage.Name, Labels: labels},
+		Spec: manifestServiceSpec{
+			Selector: labels,
+			Ports:    []manifestServicePort{{Name: "http", Port: stage.Port, TargetPort: stage.Port}},
+		},
+	}
+}
+
+func kustomizeConfigMap(stage KubernetesStage, settings map[string]string) manifestConfigMap {
+	configMap := manifestConfigMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   manifestMetadata{Name: configMapName(stage.Name)},
+	}
+
+	if logSeverity, ok := settings[settingLogSeverity]; ok {
+		configMap.Data = map[string]string{"LOG_SEVERITY": logSeverity}
+	}
+
+	return configMap
+}
+
+func marshalManifest(manifest interface{}) (string, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(manifest); err != nil {
+		return "", err
+	}
+	encoder.Close()
+
+	return buffer.String(), nil
+}
+
+// kustomizeTier is one environment of a kustomize build, with every stage
+// resolved.
+type kustomizeTier struct {
+	Builder *Builder
+	Stages  map[string]KubernetesStage
+}
+
+func (t kustomizeTier) deploymentIDs() []string {
+	deploymentIDs := make([]string, 0, len(t.Stages))
+	for deploymentID := range t.Stages {
+		deploymentIDs = append(deploymentIDs, deploymentID)
+	}
+	sort.Strings(deploymentIDs)
+
+	return deploymentIDs
+}
+
+// KustomizeBuilder writes a Kustomize base shared by several environments
+// of a topology and an overlay per environment that patches only the
+// settings in which that environment's tier differs from the base.
+type KustomizeBuilder struct {
+	Builders   []*Builder
+	OutputPath string
+
+	Diagnostics Diagnostics
+}
+
+func NewKustomizeBuilder(builders []*Builder) *KustomizeBuilder {
+	return &KustomizeBuilder{
+		Builders:   builders,
+		OutputPath: path.Join("build", "kustomize"),
+	}
+}
+
+// loadTiers loads and validates every environment and checks that they
+// define the same deployments under distinct tiers.
+func (k *KustomizeBuilder) loadTiers() (tiers []kustomizeTier) {
+	tierPaths := map[string]string{}
+
+	for _, builder := range k.Builders {
+		if err := builder.Load(); err == nil {
+			builder.Validate()
+		}
+		// every environment shares the topology, so report its problems once
+		for _, diagnostic := range builder.Diagnostics {
+			if !k.Diagnostics.contains(diagnostic) {
+				k.Diagnostics = append(k.Diagnostics, diagnostic)
+			}
+		}
+		if builder.Diagnostics.HasErrors() {
+			continue
+		}
+
+		tier := builder.Environment.Tier
+		if otherPath, ok := tierPaths[tier]; ok {
+			k.Diagnostics.Errorf(CodeMismatchedEnvironments, builder.EnvironmentSource, "tier", "tier %q is also built from %s", tier, otherPath)
+			continue
+		}
+		tierPaths[tier] = builder.EnvironmentPath
+
+		// deployments that override the target to run elsewhere are left out
+		stages := map[string]KubernetesStage{}
+		for _, deploymentID := range builder.Environment.DeploymentsWithTarget(kubernetesTargets...) {
+			stages[deploymentID] = builder.ResolveKubernetesStage(deploymentID)
+		}
+
+		tiers = append(tiers, kustomizeTier{Builder: builder, Stages: stages})
+	}
+
+	for _, tier := range tiers {
+		for _, otherTier := range tiers {
+			for _, deploymentID := range otherTier.deploymentIDs() {
+				if _, ok := tier.Stages[deploymentID]; !ok {
+					k.Diagnostics.Errorf(CodeMismatchedEnvironments, tier.Builder.EnvironmentSource, "deployments", "deployment %q of %s is missing", deploymentID, otherTier.Builder.EnvironmentPath)
+				}
+			}
+		}
+	}
+
+	return tiers
+}
+
+// commonSettings returns the settings of a deployment that every tier agrees
+// on, and the env entries that are identical in every tier.
+func commonSettings(tiers []kustomizeTier, deploymentID string) (settings map[string]string, env map[string]manifestEnvVar) {
+	for idx, tier := range tiers {
+		stage := tier.Stages[deploymentID]
+		tierSettings := stageSettings(stage)
+		tierEnv := map[string]manifestEnvVar{}
+		for _, requirement := range stage.Env {
+			tierEnv[requirement.Name] = manifestEnv(stage, requirement)
+		}
+
+		if idx == 0 {
+			settings, env = tierSettings, tierEnv
+			continue
+		}
+
+		for setting, value := range settings {
+			if tierSettings[setting] != value {
+				delete(settings, setting)
+			}
+		}
+		for name, envVar := range env {
+			if tierEnv[name] != envVar {
+				delete(env, name)
+			}
+		}
+	}
+
+	return settings, env
+}
+
+func (d Diagnostics) contains(diagnostic Diagnostic) bool {
+	for _, existing := range d {
+		if existing == diagnostic {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedEnv(env map[string]manifestEnvVar) []manifestEnvVar {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := []manifestEnvVar{}
+	for _, name := range names {
+		sorted = append(sorted, env[name])
+	}
+
+	return sorted
+}
+
+func (k *KustomizeBuilder) writeManifests(directory string, manifests map[string]interface{}) (err error) {
+	if err = os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	for fileName, manifest := range manifests {
+		rendered, ok := manifest.(string)
+		if !ok {
+			if rendered, err = marshalManifest(manifest); err != nil {
+				return err
+			}
+		}
+
+		if err = ioutil.WriteFile(path.Join(directory, fileName), []byte(rendered), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stageAutoscaler is the file name and manifest of the autoscaler of a
+// stage, or empty when it does not autoscale.
+func stageAutoscaler(stage KubernetesStage) (fileName string, manifest string) {
+	for fileName, manifest := range autoscalingManifests(stage) {
+		return fileName, manifest
+	}
+
+	return "", ""
+}
+
+// FillAutoscalerPatch renders the settings of the autoscaler of a stage that
+// tiers may change: its replica bounds and, for KEDA, the triggers with
+// their lag threshold, which replace those of the base as a whole.
+func FillAutoscalerPatch(stage KubernetesStage) string {
+	if stage.ScalesOnLag() {
+		return fmt.Sprintf(`apiVersion: keda.sh/v1alpha1
+kind: ScaledObject
+metadata:
+  name: %s
+spec:
+  minReplicaCount: %d
+  maxReplicaCount: %d
+  triggers:
+%s
+`, stage.Name, stage.Replicas, stage.MaxReplicas, scaledObjectTriggers(stage))
+	}
+
+	return fmt.Sprintf(`apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: %s
+spec:
+  minReplicas: %d
+  maxReplicas: %d
+`, stage.Name, hpaMinReplicas(stage), stage.MaxReplicas)
+}
+
+// FillBaseKustomization lists the manifests of every deployment in the
+// base, given the autoscaler file of the deployments whose tiers all
+// autoscale the same way.
+func FillBaseKustomization(deploymentIDs []string, autoscalers map[string]string) string {
+	resources := ""
+	for _, deploymentID := range deploymentIDs {
+		fileNames := []string{"configmap.yaml", "deployment.yaml", "service.yaml"}
+		if autoscaler, ok := autoscalers[deploymentID]; ok {
+			fileNames = append(fileNames, autoscaler)
+			sort.Strings(fileNames)
+		}
+
+		for _, fileName := range fileNames {
+			resources += fmt.Sprintf("  - %s/%s\n", deploymentID, fileName)
+		}
+	}
+
+	return fmt.Sprintf(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+%s`, resources)
+}
+
+// FillOverlayKustomization places the base and the tier's own resources in
+// the tier's namespace, points its images at the tier's container repo and
+// tag and applies the tier's patches. Without an imageTag in the environment
+// the tag is left to be set when deploying, with kustomize edit set image.
+func FillOverlayKustomization(namespace string, stages []KubernetesStage, resources []string, patches []string) string {
+	images := ""
+	for _, stage := range stages {
+		images += fmt.Sprintf("  - name: %s\n    newName: %s\n", stage.Name, stage.Image)
+		if stage.ImageTag != "" {
+			images += fmt.Sprintf("    newTag: %s\n", jsonLiteral(stage.ImageTag))
+		}
+	}
+
+	resourceList := ""
+	for _, resource := range resources {
+		resourceList += fmt.Sprintf("  - %s\n", resource)
+	}
+
+	kustomization := fmt.Sprintf(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: %s
+resources:
+  - ../../base
+%simages:
+%s`, namespace, resourceList, images)
+
+	if len(patches) > 0 {
+		kustomization += "patches:\n"
+		for _, patch := range patches {
+			kustomization += fmt.Sprintf("  - path: %s\n", patch)
+		}
+	}
+
+	return kustomization
+}
+
+// fail records an error that stopped the build as diagnostics and returns
+// them.
+func (k *KustomizeBuilder) fail(err error) error {
+	diagnostics := errorDiagnostics(err)
+	k.Diagnostics = append(k.Diagnostics, diagnostics...)
+	return diagnostics
+}
+
+// Build loads every environment, then writes base/ with the settings the
+// tiers share and overlays/<tier>/ with the settings each tier changes.
+func (k *KustomizeBuilder) Build() (err error) {
+	k.Diagnostics = nil
+
+	tiers := k.loadTiers()
+	if k.Diagnostics.HasErrors() {
+		return k.Diagnostics
+	}
+
+	os.RemoveAll(k.OutputPath)
+
+	deploymentIDs := tiers[0].deploymentIDs()
+	basePath := path.Join(k.OutputPath, "base")
+
+	baseSettings := map[string]map[string]string{}
+	baseEnv := map[string]map[string]manifestEnvVar{}
+	baseAutoscalers := map[string]string{}
+	for _, deploymentID := range deploymentIDs {
+		stage := tiers[0].Stages[deploymentID]
+		baseSettings[deploymentID], baseEnv[deploymentID] = commonSettings(tiers, deploymentID)
+
+		manifests := map[string]interface{}{
+			"configmap.yaml":  kustomizeConfigMap(stage, baseSettings[deploymentID]),
+			"deployment.yaml": kustomizeDeployment(stage, baseSettings[deploymentID], sortedEnv(baseEnv[deploymentID]), true),
+			"service.yaml":    kustomizeService(stage),
+		}
+
+		// an autoscaler goes into the base when every tier scales the same way
+		fileName, autoscaler := stageAutoscaler(stage)
+		for _, tier := range tiers[1:] {
+			if tierFileName, _ := stageAutoscaler(tier.Stages[deploymentID]); tierFileName != fileName {
+				fileName = ""
+			}
+		}
+		if fileName != "" {
+			manifests[fileName] = autoscaler
+			baseAutoscalers[deploymentID] = fileName
+		}
+
+		if err = k.writeManifests(path.Join(basePath, deploymentID), manifests); err != nil {
+			return k.fail(err)
+		}
+	}
+
+	if err = ioutil.WriteFile(path.Join(basePath, "kustomization.yaml"), []byte(FillBaseKustomization(deploymentIDs, baseAutoscalers)), 0644); err != nil {
+		return k.fail(err)
+	}
+
+	for _, tier := range tiers {
+		manifests := map[string]interface{}{}
+		resources := []string{}
+		patches := []string{}
+		stages := []KubernetesStage{}
+
+		for _, deploymentID := range deploymentIDs {
+			stage := tier.Stages[deploymentID]
+			stages = append(stages, stage)
+
+			settings := stageSettings(stage)
+			for setting := range baseSettings[deploymentID] {
+				delete(settings, setting)
+			}
+
+			env := map[string]manifestEnvVar{}
+			for _, requirement := range stage.Env {
+				if _, ok := baseEnv[deploymentID][requirement.Name]; !ok {
+					env[requirement.Name] = manifestEnv(stage, requirement)
+				}
+			}
+
+			deployment := kustomizeDeployment(stage, settings, sortedEnv(env), false)
+			if deployment.Spec.Replicas != nil || deployment.Spec.Template != nil {
+				fileName := deploymentID + "-deployment.yaml"
+				manifests[fileName] = deployment
+				patches = append(patches, fileName)
+			}
+
+			if _, ok := settings[settingLogSeverity]; ok {
+				fileName := deploymentID + "-configmap.yaml"
+				manifests[fileName] = kustomizeConfigMap(stage, settings)
+				patches = append(patches, fileName)
+			}
+
+			if baseFileName, ok := baseAutoscalers[deploymentID]; ok {
+				if patch := FillAutoscalerPatch(stage); patch != FillAutoscalerPatch(tiers[0].Stages[deploymentID]) {
+					fileName := deploymentID + "-" + baseFileName
+					manifests[fileName] = patch
+					patches = append(patches, fileName)
+				}
+			} else if fileName, autoscaler := stageAutoscaler(stage); fileName != "" {
+				fileName = deploymentID + "-" + fileName
+				manifests[fileName] = autoscaler
+				resources = append(resources, fileName)
+			}
+		}
+
+		manifests["kustomization.yaml"] = FillOverlayKustomization(tier.Builder.Environment.Namespace, stages, resources, patches)
+
+		if err = k.writeManifests(path.Join(k.OutputPath, "overlays", tier.Builder.Environment.Tier), manifests); err != nil {
+			return k.fail(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const expectedStagingPredictArrivalsPatch = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: predict-arrivals
+spec:
+  template:
+    spec:
+      containers:
+        - name: predict-arrivals
+          env:
+            - name: STAGING_KAFKA_ENDPOINT
+              valueFrom:
+                secretKeyRef:
+                  name: predict-arrivals-env
+                  key: STAGING_KAFKA_ENDPOINT
+          resources:
+            limits:
+              cpu: 500m
+`
+
+func TestKustomizeBuild(t *testing.T) {
+	kustomizeBuilder := NewKustomizeBuilder([]*Builder{
+		NewBuilder("fixtures/topology.json", "fixtures/environment.json"),
+		NewBuilder("fixtures/topology.json", "fixtures/overlays/staging.yaml"),
+	})
+
+	err := kustomizeBuilder.Build()
+	if err != nil {
+		t.Errorf("Build did not complete successfully: %s", err)
+	}
+
+	expectedItems := []string{
+		"build/kustomize/base/kustomization.yaml",
+		"build/kustomize/base/predict-arrivals/configmap.yaml",
+		"build/kustomize/base/predict-arrivals/deployment.yaml",
+		"build/kustomize/base/predict-arrivals/service.yaml",
+		"build/kustomize/overlays/production/kustomization.yaml",
+		"build/kustomize/overlays/production/predict-arrivals-deployment.yaml",
+		"build/kustomize/overlays/staging/kustomization.yaml",
+		"build/kustomize/overlays/staging/notify-arrivals-deployment.yaml",
+		"build/kustomize/overlays/staging/predict-arrivals-deployment.yaml",
+	}
+
+	for _, item := range expectedItems {
+		if _, err := os.Stat(item); os.IsNotExist(err) {
+			t.Errorf("Build did not create expected file: %s", item)
+		}
+	}
+
+	patchBytes, err := ioutil.ReadFile("build/kustomize/overlays/staging/predict-arrivals-deployment.yaml")
+	if err != nil {
+		t.Errorf("Could not read patch: %s", err)
+	}
+
+	if string(patchBytes) != expectedStagingPredictArrivalsPatch {
+		t.Errorf("patch did not match:-->%s<-- vs. -->%s<--", patchBytes, expectedStagingPredictArrivalsPatch)
+	}
+
+	expectedImages := map[string]string{
+		"production": "images:\n  - name: notify-arrivals\n    newName: tpark.azurecr.io/tpark/notify-arrivals\n  - name: predict-arrivals\n",
+		"staging":    "images:\n  - name: notify-arrivals\n    newName: tpark.azurecr.io/tpark/notify-arrivals\n    newTag: \"staging\"\n",
+	}
+	for tier, expected := range expectedImages {
+		kustomizationBytes, err := ioutil.ReadFile("build/kustomize/overlays/" + tier + "/kustomization.yaml")
+		if err != nil {
+			t.Errorf("Could not read kustomization: %s", err)
+		}
+
+		if !strings.Contains(string(kustomizationBytes), expected) {
+			t.Errorf("%s kustomization.yaml did not contain -->%s<--: %s", tier, expected, kustomizationBytes)
+		}
+	}
+}
+
+func TestKustomizeBuildAutoscalers(t *testing.T) {
+	kustomizeBuilder := NewKustomizeBuilder([]*Builder{
+		NewBuilder("fixtures/topology.json", "fixtures/environment.json"),
+		NewBuilder("fixtures/topology.json", "fixtures/overlays/autoscaling.yaml"),
+	})
+
+	err := kustomizeBuilder.Build()
+	if err != nil {
+		t.Errorf("Build did not complete successfully: %s", err)
+	}
+
+	// production does not autoscale, so the autoscalers belong to the overlay
+	expectedResources := "resources:\n  - ../../base\n  - predict-arrivals-scaledobject.yaml\n  - write-locations-hpa.yaml\n"
+	kustomizationBytes, err := ioutil.ReadFile("build/kustomize/overlays/autoscaling/kustomization.yaml")
+	if err != nil {
+		t.Errorf("Could not read kustomization: %s", err)
+	}
+
+	if !strings.Contains(string(kustomizationBytes), expectedResources) {
+		t.Errorf("kustomization.yaml did not contain -->%s<--: %s", expectedResources, kustomizationBytes)
+	}
+
+	scaledObjectBytes, err := ioutil.ReadFile("build/kustomize/overlays/autoscaling/predict-arrivals-scaledobject.yaml")
+	if err != nil {
+		t.Errorf("Could not read scaled object: %s", err)
+	}
+
+	if !strings.Contains(string(scaledObjectBytes), "maxReplicaCount: 8") || !strings.Contains(string(scaledObjectBytes), `lagThreshold: "100"`) {
+		t.Errorf("scaled object did not carry the tier's replicas and lag threshold: %s", scaledObjectBytes)
+	}
+
+	if _, err := os.Stat("build/kustomize/base/write-locations/hpa.yaml"); !os.IsNotExist(err) {
+		t.Errorf("Build should not put an autoscaler into the base that not every tier uses")
+	}
+}
+
+func TestFillAutoscalerPatch(t *testing.T) {
+	stage := KubernetesStage{Name: "write-locations", Replicas: 1, MaxReplicas: 3}
+	expected := `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: write-locations
+spec:
+  minReplicas: 1
+  maxReplicas: 3
+`
+
+	patch := FillAutoscalerPatch(stage)
+	if patch != expected {
+		t.Errorf("autoscaler patch did not match:-->%s<-- vs. -->%s<--", patch, expected)
+	}
+}
+
+func TestKustomizeRequiresDistinctTiers(t *testing.T) {
+	kustomizeBuilder := NewKustomizeBuilder([]*Builder{
+		NewBuilder("fixtures/topology.json", "fixtures/environment.json"),
+		NewBuilder("fixtures/topology.json", "fixtures/environment.yaml"),
+	})
+
+	err := kustomizeBuilder.Build()
+	if err == nil {
+		t.Errorf("Build should fail when two environments share a tier")
+	}
+
+	if !kustomizeBuilder.Diagnostics.HasCode(CodeMismatchedEnvironments) {
+		t.Errorf("expected a mismatched-environments diagnostic, got: %s", kustomizeBuilder.Diagnostics)
+	}
+}
@@ -1,47 +1,483 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	exitOK         = 0
+	exitValidation = 1
+	exitUsage      = 2
+	exitIO         = 3
 )
 
 func printHelp() {
-	fmt.Println("usage: topo build <topology definition> <environment definition>: builds code and scripts for deployment and execution.")
+	fmt.Println("usage: topo build [--format text|json] <topology definition> <environment definition>: builds code and scripts for deployment and execution.")
+	fmt.Println("       topo build --kustomize [--format text|json] <topology definition> <environment definition>...: writes a kustomize base shared by the environments and an overlay per tier with only its differences to build/kustomize.")
+	fmt.Println("       topo validate [--format text|json] <topology definition> <environment definition>: checks definitions for problems without building.")
+	fmt.Println("       topo resolve [--format json|yaml] <environment definition>: prints the environment with everything it extends merged in.")
+	fmt.Println("       topo explain [--format text|json] <topology definition> <environment definition> <deployment id>: shows every effective setting of a deployment and where it came from.")
+	fmt.Println("       topo env [--format text|json] [--output dir] <topology definition> <environment definition>: lists the environment variables each deployment reads, optionally writing .env.example and Secret skeletons to dir/<deployment>.")
+	fmt.Println("       topo deps [--format text|json] <topology definition> <environment definition>: lists the npm packages of the node.js deployments with the range that satisfies every processor and connection asking for them, failing on conflicting ranges.")
+	fmt.Println("       topo graph [--format dot|mermaid|svg] [--output file] <topology definition> [environment definition]: draws the topology, grouped by deployment when an environment is given.")
+	fmt.Println("")
+	fmt.Println("commands that read an environment also accept --var name=value and --var-file <file> to set ${vars.name}.")
+	fmt.Println("definitions may be written in JSON (.json) or YAML (.yaml, .yml).")
+	fmt.Println("the environment target selects what build emits: kubernetes-helm (the default, also kubernetes), kubernetes-manifests, compose or systemd; a deployment may override it with its own target.")
+	fmt.Println("processors may be written for node.js (.js or .ts, compiled with tsc), python or go (whose processor file is a package path); other platforms are built by a topo-platform-<platform> executable in .topo/plugins next to the topology definition or on PATH, which reads the deployment as JSON on stdin and writes the files to generate as JSON on stdout.")
+	fmt.Println("exit codes: 1 validation failed, 2 usage error, 3 file could not be read or written.")
 	fmt.Println("")
 	fmt.Println("example: topo build location-pipeline.json production.json")
 }
 
+func usageError() {
+	printHelp()
+	os.Exit(exitUsage)
+}
+
+// parseArgs parses flags wherever they appear among the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		err = flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringsFlag collects every value of a flag that may be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+type commandOptions struct {
+	Format   string
+	Vars     stringsFlag
+	VarFiles stringsFlag
+}
+
+func addVariableFlags(flags *flag.FlagSet, options *commandOptions) {
+	flags.Var(&options.Vars, "var", "set ${vars.name} in the environment, as name=value (may be repeated)")
+	flags.Var(&options.VarFiles, "var-file", "JSON or YAML file of vars for the environment (may be repeated)")
+}
+
+func newCommandFlags(name string, options *commandOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&options.Format, "format", "text", "diagnostic output format: text or json")
+	addVariableFlags(flags, options)
+	return flags
+}
+
+// newBuilder creates a builder with the command line vars applied.
+func (o *commandOptions) newBuilder(topologyPath string, environmentPath string) *Builder {
+	builder := NewBuilder(topologyPath, environmentPath)
+	builder.VariableFiles = o.VarFiles
+
+	if len(o.Vars) > 0 {
+		builder.Variables = map[string]interface{}{}
+	}
+	for _, assignment := range o.Vars {
+		name, value, err := ParseVariable(assignment)
+		if err != nil {
+			fmt.Println(err)
+			usageError()
+		}
+		builder.Variables[name] = value
+	}
+
+	return builder
+}
+
+func parseCommand(flags *flag.FlagSet, options *commandOptions, argCount int) (positional []string) {
+	return parseCommandArgs(flags, options, argCount, argCount)
+}
+
+// parseCommandArgs parses a command that takes between minArgs and maxArgs
+// positional arguments, or at least minArgs if maxArgs is negative.
+func parseCommandArgs(flags *flag.FlagSet, options *commandOptions, minArgs int, maxArgs int) (positional []string) {
+	positional, err := parseArgs(flags, os.Args[2:])
+	if err != nil || len(positional) < minArgs || (maxArgs >= 0 && len(positional) > maxArgs) {
+		usageError()
+	}
+
+	if options.Format != "text" && options.Format != "json" {
+		fmt.Printf("unknown format %s\n", options.Format)
+		usageError()
+	}
+
+	return positional
+}
+
+func printDiagnostics(diagnostics Diagnostics, format string) {
+	if format == "json" {
+		if diagnostics == nil {
+			diagnostics = Diagnostics{}
+		}
+		diagnosticsJSON, _ := json.MarshalIndent(diagnostics, "", "    ")
+		fmt.Println(string(diagnosticsJSON))
+		return
+	}
+
+	for _, diagnostic := range diagnostics {
+		fmt.Printf("%s: %s [%s]\n", diagnostic.Severity, diagnostic, diagnostic.Code)
+	}
+}
+
+func diagnosticsExitCode(diagnostics Diagnostics) int {
+	if diagnostics.HasCode(CodeIOError) {
+		return exitIO
+	}
+
+	if diagnostics.HasErrors() {
+		return exitValidation
+	}
+
+	return exitOK
+}
+
 func buildDeployment() {
-	if len(os.Args) != 4 {
-		printHelp()
-		os.Exit(1)
+	var kustomize bool
+	options := commandOptions{}
+	flags := newCommandFlags("build", &options)
+	flags.BoolVar(&kustomize, "kustomize", false, "write a kustomize base and an overlay per environment to build/kustomize")
+
+	positional := parseCommandArgs(flags, &options, 2, -1)
+	if kustomize {
+		buildKustomize(positional[0], positional[1:], options)
+		return
+	}
+	if len(positional) != 2 {
+		usageError()
 	}
 
-	builder := NewBuilder(os.Args[2], os.Args[3])
+	builder := options.newBuilder(positional[0], positional[1])
 	err := builder.Build()
+
+	printDiagnostics(builder.Diagnostics, options.Format)
+
+	if _, ok := err.(Diagnostics); ok {
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "building environment failed with error: %s\n", err)
+		os.Exit(exitIO)
+	}
+}
+
+func buildKustomize(topologyPath string, environmentPaths []string, options commandOptions) {
+	builders := []*Builder{}
+	for _, environmentPath := range environmentPaths {
+		builders = append(builders, options.newBuilder(topologyPath, environmentPath))
+	}
+
+	kustomizeBuilder := NewKustomizeBuilder(builders)
+	err := kustomizeBuilder.Build()
+
+	printDiagnostics(kustomizeBuilder.Diagnostics, options.Format)
+
+	if _, ok := err.(Diagnostics); ok {
+		os.Exit(diagnosticsExitCode(kustomizeBuilder.Diagnostics))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "building kustomize overlays failed with error: %s\n", err)
+		os.Exit(exitIO)
+	}
+}
+
+func validateDefinitions() {
+	options := commandOptions{}
+	positional := parseCommand(newCommandFlags("validate", &options), &options, 2)
+
+	builder := options.newBuilder(positional[0], positional[1])
+	if err := builder.Load(); err == nil {
+		builder.Validate()
+	}
+
+	printDiagnostics(builder.Diagnostics, options.Format)
+	os.Exit(diagnosticsExitCode(builder.Diagnostics))
+}
+
+func renderGraph() {
+	var format, output string
+	options := commandOptions{}
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	addVariableFlags(flags, &options)
+	flags.StringVar(&format, "format", "dot", "graph output format: dot, mermaid or svg")
+	flags.StringVar(&output, "output", "", "file to write the graph to instead of stdout")
+
+	positional, err := parseArgs(flags, os.Args[2:])
+	if err != nil || len(positional) < 1 || len(positional) > 2 {
+		usageError()
+	}
+
+	builder := options.newBuilder(positional[0], "")
+	_, err = builder.LoadTopology()
+
+	var environment *Environment
+	if err == nil && len(positional) == 2 {
+		builder.EnvironmentPath = positional[1]
+		environment, err = builder.LoadEnvironment()
+	}
+
 	if err != nil {
-		fmt.Printf("building environment failed with error: %s\n", err)
+		printDiagnostics(builder.Diagnostics, "text")
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	}
+
+	renderer := NewGraphRenderer(builder.Topology, environment)
+
+	var rendered string
+	switch format {
+	case "dot":
+		rendered = renderer.RenderDOT()
+	case "mermaid":
+		rendered = renderer.RenderMermaid()
+	case "svg":
+		rendered = renderer.RenderSVG()
+	default:
+		fmt.Printf("unknown format %s\n", format)
+		usageError()
+	}
+
+	if output == "" {
+		fmt.Print(rendered)
+		return
+	}
+
+	err = ioutil.WriteFile(output, []byte(rendered), 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "writing graph failed with error: %s\n", err)
+		os.Exit(exitIO)
 	}
 }
 
+func resolveEnvironment() {
+	var format string
+	options := commandOptions{}
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	addVariableFlags(flags, &options)
+	flags.StringVar(&format, "format", "json", "output format: json or yaml")
+
+	positional, err := parseArgs(flags, os.Args[2:])
+	if err != nil || len(positional) != 1 {
+		usageError()
+	}
+
+	builder := options.newBuilder("", positional[0])
+	_, err = builder.LoadEnvironment()
+	if err != nil {
+		printDiagnostics(builder.Diagnostics, "text")
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	}
+
+	var resolved []byte
+	switch format {
+	case "json":
+		resolved, err = json.MarshalIndent(builder.EnvironmentDocument, "", "    ")
+		resolved = append(resolved, '\n')
+	case "yaml":
+		resolved, err = yaml.Marshal(builder.EnvironmentDocument)
+	default:
+		fmt.Printf("unknown format %s\n", format)
+		usageError()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolving environment failed with error: %s\n", err)
+		os.Exit(exitValidation)
+	}
+
+	fmt.Print(string(resolved))
+}
+
+func explainDeployment() {
+	options := commandOptions{}
+	positional := parseCommand(newCommandFlags("explain", &options), &options, 3)
+
+	builder := options.newBuilder(positional[0], positional[1])
+	if err := builder.Load(); err != nil {
+		printDiagnostics(builder.Diagnostics, options.Format)
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	}
+
+	values, err := builder.Explain(positional[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "explaining deployment failed with error: %s\n", err)
+		os.Exit(exitValidation)
+	}
+
+	if options.Format == "json" {
+		valuesJSON, _ := json.MarshalIndent(values, "", "    ")
+		fmt.Println(string(valuesJSON))
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+	for _, value := range values {
+		if value.Default {
+			fmt.Fprintf(writer, "%s\t(default)\t\n", value.Setting)
+		} else {
+			fmt.Fprintf(writer, "%s\t%v\t%s %s\n", value.Setting, value.Value, formatPosition(value.Source), value.Path)
+		}
+
+		for _, overridden := range value.Overridden {
+			fmt.Fprintf(writer, "  overrides\t%v\t%s\n", overridden.Value, formatPosition(overridden.Position))
+		}
+	}
+	writer.Flush()
+}
+
+func listEnvironmentVariables() {
+	var output string
+	options := commandOptions{}
+	flags := newCommandFlags("env", &options)
+	flags.StringVar(&output, "output", "", "directory to write <deployment>/.env.example and <deployment>/secret.yaml to")
+	positional := parseCommand(flags, &options, 2)
+
+	builder := options.newBuilder(positional[0], positional[1])
+	if err := builder.Load(); err != nil {
+		printDiagnostics(builder.Diagnostics, options.Format)
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	}
+
+	deploymentIds := sortedDeploymentIds(builder.Environment.Deployments)
+	inventory := map[string][]EnvRequirement{}
+	for _, deploymentID := range deploymentIds {
+		inventory[deploymentID] = collectEnvRequirements(builder.Environment.Deployments[deploymentID], builder.Topology, builder.Environment)
+	}
+
+	if options.Format == "json" {
+		inventoryJSON, _ := json.MarshalIndent(inventory, "", "    ")
+		fmt.Println(string(inventoryJSON))
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, deploymentID := range deploymentIds {
+			fmt.Fprintf(writer, "deployment %s\n", deploymentID)
+			for _, requirement := range inventory[deploymentID] {
+				usages := []string{}
+				for _, usage := range requirement.UsedBy {
+					usages = append(usages, usage.String())
+				}
+				if requirement.IsSecret() {
+					usages = append(usages, fmt.Sprintf("secret %s/%s", requirement.SecretName, requirement.SecretKey))
+				}
+				fmt.Fprintf(writer, "  %s\t%s\n", requirement.Name, strings.Join(usages, ", "))
+			}
+		}
+		writer.Flush()
+	}
+
+	if output == "" {
+		return
+	}
+
+	for _, deploymentID := range deploymentIds {
+		deploymentPath := path.Join(output, deploymentID)
+		err := os.MkdirAll(deploymentPath, 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path.Join(deploymentPath, ".env.example"), []byte(FillEnvExample(deploymentID, inventory[deploymentID])), 0644)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(path.Join(deploymentPath, "secret.yaml"), []byte(FillSecretSkeleton(deploymentID, builder.Environment.Namespace, inventory[deploymentID])), 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing environment files failed with error: %s\n", err)
+			os.Exit(exitIO)
+		}
+	}
+}
+
+func listDependencies() {
+	options := commandOptions{}
+	positional := parseCommand(newCommandFlags("deps", &options), &options, 2)
+
+	builder := options.newBuilder(positional[0], positional[1])
+	if err := builder.Load(); err != nil {
+		printDiagnostics(builder.Diagnostics, options.Format)
+		os.Exit(diagnosticsExitCode(builder.Diagnostics))
+	}
+
+	resolved, diagnostics := builder.ResolveDependencies()
+	builder.Diagnostics = append(builder.Diagnostics, diagnostics...)
+
+	if options.Format == "json" {
+		if resolved == nil {
+			resolved = []ResolvedDependency{}
+		}
+		resolvedJSON, _ := json.MarshalIndent(resolved, "", "    ")
+		fmt.Println(string(resolvedJSON))
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, dependency := range resolved {
+			resolvedRange := dependency.Range
+			if dependency.Conflict {
+				resolvedRange = "(conflict)"
+			}
+			fmt.Fprintf(writer, "%s\t%s\n", dependency.Name, resolvedRange)
+			for _, request := range dependency.RequestedBy {
+				fmt.Fprintf(writer, "  %s %s\t%s\n", request.Kind, request.ID, request.Range)
+			}
+		}
+		writer.Flush()
+
+		printDiagnostics(diagnostics, options.Format)
+	}
+
+	os.Exit(diagnosticsExitCode(builder.Diagnostics))
+}
+
 func printVersion() {
 	fmt.Println("v1.0.0")
 }
 
 func main() {
 	if len(os.Args) <= 1 {
-		printHelp()
-		os.Exit(1)
+		usageError()
 	}
 
 	switch os.Args[1] {
 	case "build":
 		buildDeployment()
+	case "validate":
+		validateDefinitions()
+	case "resolve":
+		resolveEnvironment()
+	case "explain":
+		explainDeployment()
+	case "env":
+		listEnvironmentVariables()
+	case "deps":
+		listDependencies()
+	case "graph":
+		renderGraph()
 	case "version":
 		printVersion()
 	case "help":
 		printHelp()
 	default:
-		printHelp()
+		usageError()
 	}
 }
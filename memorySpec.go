@@ -1,6 +1,6 @@
 package main
 
 type MemorySpec struct {
-	Request string
-	Limit   string
+	Request string `json:"request,omitempty"`
+	Limit   string `json:"limit,omitempty"`
 }
@@ -1,7 +1,8 @@
 package main
 
 type Node struct {
-	Inputs    []string
-	Processor ProcessorSpec
-	Outputs   []string
+	Inputs     []string      `json:"inputs,omitempty"`
+	Processor  ProcessorSpec `json:"processor"`
+	Outputs    []string      `json:"outputs,omitempty"`
+	AllowCycle bool          `json:"allowCycle,omitempty"`
 }
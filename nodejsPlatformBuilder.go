@@ -9,21 +9,34 @@ import (
 	"strings"
 )
 
+const nodeJsPlatform = "node.js"
+
 type NodeJsPlatformBuilder struct {
 	DeploymentID string
 	Deployment   Deployment
 	Topology     Topology
 	Environment  Environment
 
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+
 	DeploymentPath string
 	CodePath       string
 	ProcessorPath  string
 }
 
-const deployStageTemplate = `#/bin/bash
-
-CONTAINER_REPO=%s SERVICE_NAME=%s SERVICE_NAMESPACE=%s APP_TYPE=pipeline-stage ../common/deploy-stage
-`
+func init() {
+	RegisterPlatformBuilder(nodeJsPlatform, func(context PlatformContext) PlatformBuilder {
+		return &NodeJsPlatformBuilder{
+			DeploymentID:      context.DeploymentID,
+			Deployment:        context.Deployment,
+			Topology:          context.Topology,
+			Environment:       context.Environment,
+			TopologySource:    context.TopologySource,
+			EnvironmentSource: context.EnvironmentSource,
+		}
+	})
+}
 
 const dockerFile = `FROM node:dubnium
 
@@ -37,6 +50,43 @@ EXPOSE 80
 CMD [ "./start-stage" ]
 `
 
+// typeScriptDockerFile compiles the stage in a build stage, as TypeScript
+// needs a newer node than the stage runs on, and keeps only its output.
+const typeScriptDockerFile = `FROM node:18 AS build
+
+WORKDIR /app
+
+COPY . .
+RUN npm install && npm run build
+
+FROM node:dubnium
+
+WORKDIR /app
+
+COPY . .
+COPY --from=build /app/dist ./dist
+RUN npm install --production
+
+EXPOSE 80
+
+CMD [ "./start-stage" ]
+`
+
+// tsconfigJsonTemplate compiles stage.ts and the directories of the
+// processor modules, JavaScript ones included, into dist.
+const tsconfigJsonTemplate = `{
+    "compilerOptions": {
+        "target": "es2018",
+        "module": "commonjs",
+        "outDir": "dist",
+        "allowJs": true,
+        "esModuleInterop": true,
+        "skipLibCheck": true
+    },
+    "include": [%s]
+}
+`
+
 const startStage = `#!/bin/bash
 
 export PORT=80
@@ -44,26 +94,95 @@ export PORT=80
 npm start
 `
 
-func (b *NodeJsPlatformBuilder) collectDependencies() (dependencies map[string]string) {
-	dependencies = map[string]string{}
-	for _, connection := range b.Environment.Connections {
-		for packageName, version := range connection.Dependencies {
-			dependencies[packageName] = version
+// Validate checks that the connections of the deployment are node.js
+// packages, that its processors are JavaScript or TypeScript modules, that
+// every local module they require or import exists in the project and that
+// the versions they and the connections ask for of each package agree.
+func (b *NodeJsPlatformBuilder) Validate() (diagnostics Diagnostics) {
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		platform := b.Environment.Connections[connectionId].Platform
+		if platform != "" && platform != nodeJsPlatform {
+			diagnostics.Errorf(CodeMismatchedPlatform, b.EnvironmentSource, joinPath(joinPath("connections", connectionId), "platform"), "connection %q is built for platform %s, but deployment %q runs %s", connectionId, platform, b.DeploymentID, nodeJsPlatform)
 		}
 	}
 
 	for _, nodeId := range b.Deployment.Nodes {
-		node := b.Topology.Nodes[nodeId]
-		for packageName, version := range node.Processor.Dependencies {
-			dependencies[packageName] = version
+		file := b.Topology.Nodes[nodeId].Processor.File
+		filePath := joinPath(joinPath("nodes", nodeId), "processor.file")
+
+		entry := processorEntry(file)
+		if path.Ext(entry) != ".js" && path.Ext(entry) != ".ts" {
+			diagnostics.Errorf(CodeInvalidProcessor, b.TopologySource, filePath, "processor file %s of node %q is not a JavaScript or TypeScript module", file, nodeId)
+			continue
+		}
+
+		files, missing := collectProcessorModules(file)
+		for _, missingImport := range missing {
+			// a missing processor file is reported by the validator
+			if missingImport.File != "" {
+				diagnostics.Errorf(CodeMissingImport, b.TopologySource, filePath, "%s imported by %s of node %q does not exist", missingImport.Specifier, missingImport.File, nodeId)
+			}
+		}
+		for _, moduleFile := range files {
+			if strings.HasPrefix(moduleFile, "../") {
+				diagnostics.Errorf(CodeInvalidProcessor, b.TopologySource, filePath, "%s needed by node %q is outside of the project and cannot be copied into the build", moduleFile, nodeId)
+			}
+		}
+	}
+
+	return append(diagnostics, dependencyConflicts(b.resolvedDependencies(), b.TopologySource, b.EnvironmentSource)...)
+}
+
+// typeScriptNodes lists the nodes of the deployment whose processors are
+// written in TypeScript.
+func (b *NodeJsPlatformBuilder) typeScriptNodes() (nodeIds []string) {
+	for _, nodeId := range b.Deployment.Nodes {
+		if path.Ext(processorEntry(b.Topology.Nodes[nodeId].Processor.File)) == ".ts" {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+
+	return nodeIds
+}
+
+// UsesTypeScript tells whether the stage is generated as stage.ts and
+// compiled with tsc, which it is as soon as one processor is TypeScript.
+func (b *NodeJsPlatformBuilder) UsesTypeScript() bool {
+	return len(b.typeScriptNodes()) > 0
+}
+
+func (b *NodeJsPlatformBuilder) Image() PlatformImage {
+	if b.UsesTypeScript() {
+		return PlatformImage{
+			Dockerfile: typeScriptDockerFile,
+			Install:    []string{"npm", "install"},
+			Build:      []string{"npm", "run", "build"},
+			Command:    []string{"node", "dist/stage.js"},
 		}
 	}
 
-	return dependencies
+	return PlatformImage{
+		Dockerfile: dockerFile,
+		Install:    []string{"npm", "install", "--production"},
+		Command:    []string{"node", "stage.js"},
+	}
+}
+
+// resolvedDependencies resolves the npm ranges that the processors of the
+// deployment and the connections they use ask for.
+func (b *NodeJsPlatformBuilder) resolvedDependencies() []ResolvedDependency {
+	return resolveDependencies(collectDependencies(b.Deployment.Nodes, b.Topology, b.Environment))
+}
+
+// Dependencies maps every package to the range that satisfies all of its
+// requesters. Conflicting packages, which Validate reports, keep the range
+// of their last requester.
+func (b *NodeJsPlatformBuilder) Dependencies() (dependencies map[string]string) {
+	return dependencyVersions(b.resolvedDependencies())
 }
 
 func (b *NodeJsPlatformBuilder) FillPackageJson() (packageJson string) {
-	dependencies := b.collectDependencies()
+	dependencies := b.Dependencies()
 	var dependencyStrings []string
 	for packageName, version := range dependencies {
 		dependencyStrings = append(dependencyStrings, fmt.Sprintf(`        "%s":"%s"`, packageName, version))
@@ -71,12 +190,31 @@ func (b *NodeJsPlatformBuilder) FillPackageJson() (packageJson string) {
 
 	sort.Strings(dependencyStrings)
 
+	dependencyList := ""
+	if len(dependencyStrings) > 0 {
+		dependencyList = ",\n" + strings.Join(dependencyStrings, ",\n")
+	}
+
+	main := "stage.js"
+	scripts := `        "start": "node stage.js"`
+	devDependencies := ""
+	if b.UsesTypeScript() {
+		main = "dist/stage.js"
+		scripts = `        "build": "tsc",
+        "start": "node dist/stage.js"`
+		devDependencies = `,
+    "devDependencies": {
+        "@types/node": "^18.0.0",
+        "typescript": "^5.4.0"
+    }`
+	}
+
 	return fmt.Sprintf(`{
     "name": "%s",
     "version": "1.0.0",
-    "main": "stage.js",
+    "main": "%s",
     "scripts": {
-        "start": "node stage.js"
+%s
     },
     "dependencies": {
         "express": "^4.16.2",
@@ -84,12 +222,14 @@ func (b *NodeJsPlatformBuilder) FillPackageJson() (packageJson string) {
 		"node-fetch": "^2.2.0",
         "prom-client": "^11.0.0",
         "request": "^2.83.0",
-        "topological": "^1.0.39",
-%s
-    }
+        "topological": "^1.0.39"%s
+    }%s
 }`,
 		b.DeploymentID,
-		strings.Join(dependencyStrings, ",\n"))
+		main,
+		scripts,
+		dependencyList,
+		devDependencies)
 }
 
 func (b *NodeJsPlatformBuilder) consolidateDeploymentConnections() (connections map[string]bool) {
@@ -126,7 +266,13 @@ func (b *NodeJsPlatformBuilder) FillImports() (imports string) {
 
 	for _, nodeId := range b.Deployment.Nodes {
 		node := b.Topology.Nodes[nodeId]
-		importString := fmt.Sprintf(`    %sProcessorClass = require('%s')`, nodeId, node.Processor.File)
+		// processors keep their path relative to the project in the build
+		modulePath := "./" + path.Clean(node.Processor.File)
+		importString := fmt.Sprintf(`    %sProcessorClass = require('%s')`, nodeId, modulePath)
+		if path.Ext(processorEntry(node.Processor.File)) == ".ts" {
+			// TypeScript processors export their class as default
+			importString = fmt.Sprintf(`    %sProcessorClass = require('%s').default`, nodeId, strings.TrimSuffix(modulePath, ".ts"))
+		}
 		processorImports = append(processorImports, importString)
 	}
 
@@ -162,21 +308,13 @@ func (b *NodeJsPlatformBuilder) FillConnections() (connectionInstantiations stri
 }
 
 func (b *NodeJsPlatformBuilder) buildConfig(config map[string]interface{}) (configJSON string) {
-	configKeys := make([]string, 0, len(config))
-	for k := range config {
-		configKeys = append(configKeys, k)
-	}
-	sort.Strings(configKeys)
-
-	configEntries := []string{}
-
-	for _, key := range configKeys {
-		secret := config[key].(string)
-		envVarName := strings.ToUpper(strings.Replace(secret, "-", "_", -1))
-		configEntries = append(configEntries, fmt.Sprintf(`"%s": process.env.%s`, key, envVarName))
+	values, err := ParseConfig(config)
+	if err != nil {
+		// config is validated before any code is generated
+		return "undefined"
 	}
 
-	return fmt.Sprintf(`{%s}`, strings.Join(configEntries, ", "))
+	return javaScriptObject(values)
 }
 
 func (b *NodeJsPlatformBuilder) FillProcessors() (processorInstantiations string) {
@@ -184,6 +322,9 @@ func (b *NodeJsPlatformBuilder) FillProcessors() (processorInstantiations string
 
 	for _, nodeID := range b.Deployment.Nodes {
 		processorConfigJSON := b.buildConfig(b.Environment.Processors[nodeID].Config)
+		if b.UsesTypeScript() {
+			processorConfigJSON += " satisfies " + configInterfaceName(nodeID)
+		}
 		processorInstantiation := fmt.Sprintf(`let %sProcessor = new %sProcessorClass({
     "id": "%s",
     "config": %s
@@ -196,16 +337,67 @@ func (b *NodeJsPlatformBuilder) FillProcessors() (processorInstantiations string
 	return strings.Join(instantiations, "\n\n")
 }
 
-func (b *NodeJsPlatformBuilder) CopyProcessors() (err error) {
-	for _, nodeId := range b.Deployment.Nodes {
-		node := b.Topology.Nodes[nodeId]
+// configInterfaceName names the config interface of a node's processor,
+// e.g. WriteLocationsConfig for writeLocations.
+func configInterfaceName(nodeId string) string {
+	return strings.ToUpper(nodeId[:1]) + nodeId[1:] + "Config"
+}
 
-		processorFileNameParts := strings.Split(node.Processor.File, "/")
-		processorFileName := processorFileNameParts[len(processorFileNameParts)-1]
-		processorPath := fmt.Sprintf("%s/%s", b.ProcessorPath, processorFileName)
+// FillConfigInterfaces exports a typed config interface per processor of
+// the deployment, derived from its config keys, for TypeScript processors
+// to import with import type from '../stage'.
+func (b *NodeJsPlatformBuilder) FillConfigInterfaces() (interfaces string) {
+	nodeIds := append([]string{}, b.Deployment.Nodes...)
+	sort.Strings(nodeIds)
 
-		err = CopyFile(node.Processor.File, processorPath)
+	declarations := []string{}
+	for _, nodeId := range nodeIds {
+		values, err := ParseConfig(b.Environment.Processors[nodeId].Config)
 		if err != nil {
+			// config is validated before any code is generated
+			values = map[string]ConfigValue{}
+		}
+
+		declarations = append(declarations, fmt.Sprintf("export interface %s %s", configInterfaceName(nodeId), typeScriptObjectType(values, "    ")))
+	}
+
+	return strings.Join(declarations, "\n\n")
+}
+
+// processorModuleFiles lists every file the processors of the deployment
+// need: their modules and the local modules those require or import.
+func (b *NodeJsPlatformBuilder) processorModuleFiles() []string {
+	files := map[string]bool{}
+	for _, nodeId := range b.Deployment.Nodes {
+		moduleFiles, _ := collectProcessorModules(b.Topology.Nodes[nodeId].Processor.File)
+		for _, file := range moduleFiles {
+			files[file] = true
+		}
+	}
+
+	return sortedKeys(files)
+}
+
+func (b *NodeJsPlatformBuilder) FillTsconfigJson() (tsconfigJson string) {
+	include := []string{jsonLiteral("stage.ts")}
+	for _, root := range moduleRoots(b.processorModuleFiles()) {
+		include = append(include, jsonLiteral(root))
+	}
+
+	return fmt.Sprintf(tsconfigJsonTemplate, strings.Join(include, ", "))
+}
+
+// CopyProcessors copies the processor modules of the deployment and the
+// local modules they import into the build, keeping their paths relative to
+// the project so that their relative imports still resolve.
+func (b *NodeJsPlatformBuilder) CopyProcessors() (err error) {
+	for _, file := range b.processorModuleFiles() {
+		destPath := path.Join(b.CodePath, file)
+		if err = os.MkdirAll(path.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		if err = CopyFile(file, destPath); err != nil {
 			return err
 		}
 	}
@@ -263,14 +455,53 @@ topology.start(err => {
 `, nodesString)
 }
 
+// FillRequiredEnv checks, before anything is instantiated, that every
+// environment variable the connections and processors read is set, and
+// exits naming all of the missing ones and what needs them if not.
+func (b *NodeJsPlatformBuilder) FillRequiredEnv() (requiredEnv string) {
+	entries := []string{}
+	for _, requirement := range collectEnvRequirements(b.Deployment, b.Topology, b.Environment) {
+		if requirement.HasDefault {
+			continue
+		}
+
+		usages := []string{}
+		for _, usage := range requirement.UsedBy {
+			usages = append(usages, jsonLiteral(usage.String()))
+		}
+		entries = append(entries, fmt.Sprintf(`    %s: [%s]`, jsonLiteral(requirement.Name), strings.Join(usages, ", ")))
+	}
+
+	return fmt.Sprintf(`const requiredEnv = {
+%s
+};
+
+const missingEnv = Object.keys(requiredEnv).filter(name => process.env[name] === undefined);
+if (missingEnv.length > 0) {
+    missingEnv.forEach(name => {
+        console.error("missing environment variable " + name + " needed by " + requiredEnv[name].join(", "));
+    });
+    process.exit(1);
+}`, strings.Join(entries, ",\n"))
+}
+
 func (b *NodeJsPlatformBuilder) FillStage() (stage string) {
 	imports := b.FillImports()
+	requiredEnv := b.FillRequiredEnv()
 	connections := b.FillConnections()
 	processors := b.FillProcessors()
 	topology := b.FillTopology()
 
+	if b.UsesTypeScript() {
+		requiredEnv = b.FillConfigInterfaces() + "\n\n" + requiredEnv
+	}
+
 	return fmt.Sprintf(`%s
 
+// CONFIGURATION ===========================================================
+
+%s
+
 // CONNECTIONS =============================================================
 
 %s
@@ -296,7 +527,7 @@ server.listen(process.env.PORT);
 topology.log.info("listening on port: " + process.env.PORT);
 
 promClient.collectDefaultMetrics();
-`, imports, connections, processors, topology)
+`, imports, requiredEnv, connections, processors, topology)
 }
 
 func CopyFile(sourcePath string, destPath string) (err error) {
@@ -311,8 +542,7 @@ func CopyFile(sourcePath string, destPath string) (err error) {
 func (b *NodeJsPlatformBuilder) BuildSource() (err error) {
 	b.DeploymentPath = path.Join("build", b.Environment.Tier, b.DeploymentID)
 
-	//  deployStage := fmt.Sprintf(deployStageTemplate, b.Environment.ContainerRepo, b.DeploymentID, b.Environment.Namespace)
-	err = ioutil.WriteFile(path.Join(b.DeploymentPath, "Dockerfile"), []byte(dockerFile), 0644)
+	err = ioutil.WriteFile(path.Join(b.DeploymentPath, "Dockerfile"), []byte(b.Image().Dockerfile), 0644)
 	if err != nil {
 		return err
 	}
@@ -336,8 +566,17 @@ func (b *NodeJsPlatformBuilder) BuildSource() (err error) {
 		return err
 	}
 
-	// create stage.js
-	err = ioutil.WriteFile(path.Join(b.CodePath, "stage.js"), []byte(b.FillStage()), 0644)
+	// create stage.js, or stage.ts and its tsconfig.json for TypeScript processors
+	stageFile := "stage.js"
+	if b.UsesTypeScript() {
+		stageFile = "stage.ts"
+		err = ioutil.WriteFile(path.Join(b.CodePath, "tsconfig.json"), []byte(b.FillTsconfigJson()), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(path.Join(b.CodePath, stageFile), []byte(b.FillStage()), 0644)
 	if err != nil {
 		return err
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -104,6 +105,24 @@ const expectedStageJs = `const { Node, Topology } = require('topological'),
     locationsConnectionClass = require('topological-kafka'),
     predictArrivalsProcessorClass = require('./processors/predictArrivals.js');
 
+// CONFIGURATION ===========================================================
+
+const requiredEnv = {
+    "ESTIMATED_ARRIVALS_KEYFIELD": ["connection estimatedArrivals: keyField"],
+    "ESTIMATED_ARRIVALS_TOPIC": ["connection estimatedArrivals: topic"],
+    "KAFKA_ENDPOINT": ["connection estimatedArrivals: endpoint", "connection locations: endpoint"],
+    "LOCATIONS_KEYFIELD": ["connection locations: keyField"],
+    "LOCATIONS_TOPIC": ["connection locations: topic"]
+};
+
+const missingEnv = Object.keys(requiredEnv).filter(name => process.env[name] === undefined);
+if (missingEnv.length > 0) {
+    missingEnv.forEach(name => {
+        console.error("missing environment variable " + name + " needed by " + requiredEnv[name].join(", "));
+    });
+    process.exit(1);
+}
+
 // CONNECTIONS =============================================================
 
 let estimatedArrivalsConnection = new estimatedArrivalsConnectionClass({
@@ -407,3 +426,86 @@ func TestBuild(t *testing.T) {
 		t.Errorf("stage.js did not match:-->%s<-- vs. -->%s<-- did not complete successfully.", stageJsBytes, expectedStageJs)
 	}
 }
+
+func TestFillRequiredEnvSkipsDefaults(t *testing.T) {
+	nodeJsBuilder := NodeJsPlatformBuilder{
+		DeploymentID: "predict-arrivals",
+		Deployment:   Deployment{Nodes: []string{"predictArrivals"}},
+		Topology: Topology{
+			Nodes: map[string]Node{
+				"predictArrivals": Node{Inputs: []string{"locations"}},
+			},
+		},
+		Environment: Environment{
+			Connections: map[string]Connection{
+				"locations": Connection{
+					Config: map[string]interface{}{
+						"endpoint": "kafka-endpoint",
+						"topic":    map[string]interface{}{"env": "LOCATIONS_TOPIC", "default": "locations"},
+					},
+				},
+			},
+			Processors: map[string]ProcessorEnv{
+				"predictArrivals": ProcessorEnv{
+					Config: map[string]interface{}{"password": map[string]interface{}{"secret": "model/password"}},
+				},
+			},
+		},
+	}
+
+	expectedRequiredEnv := `const requiredEnv = {
+    "KAFKA_ENDPOINT": ["connection locations: endpoint"],
+    "MODEL_PASSWORD": ["processor predictArrivals: password"]
+};`
+
+	requiredEnv := nodeJsBuilder.FillRequiredEnv()
+	if !strings.HasPrefix(requiredEnv, expectedRequiredEnv) {
+		t.Errorf("required env did not match:-->%s<-- vs. -->%s<--", requiredEnv, expectedRequiredEnv)
+	}
+}
+
+func TestTypeScriptImage(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/typescript-topology.json", "fixtures/environment.json", "write-locations", "")
+	nodeJsBuilder := platformBuilder.(*NodeJsPlatformBuilder)
+
+	if !nodeJsBuilder.UsesTypeScript() {
+		t.Fatalf("expected write-locations to use TypeScript")
+	}
+
+	image := nodeJsBuilder.Image()
+	if strings.Join(image.Build, " ") != "npm run build" || strings.Join(image.Command, " ") != "node dist/stage.js" {
+		t.Errorf("expected the image to compile and run dist/stage.js, got: %v", image)
+	}
+
+	packageJson := nodeJsBuilder.FillPackageJson()
+	for _, expected := range []string{`"main": "dist/stage.js"`, `"build": "tsc"`, `"typescript": "^5.4.0"`} {
+		if !strings.Contains(packageJson, expected) {
+			t.Errorf("package.json did not contain -->%s<--: %s", expected, packageJson)
+		}
+	}
+}
+
+func TestFillTypeScriptStage(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/typescript-topology.json", "fixtures/environment.json", "write-locations", "")
+	nodeJsBuilder := platformBuilder.(*NodeJsPlatformBuilder)
+
+	expectedInterfaces := `export interface WriteLocationsConfig {
+    cassandraEndpoints: string;
+}`
+
+	interfaces := nodeJsBuilder.FillConfigInterfaces()
+	if interfaces != expectedInterfaces {
+		t.Errorf("config interfaces did not match:-->%s<-- vs. -->%s<--", interfaces, expectedInterfaces)
+	}
+
+	stage := nodeJsBuilder.FillStage()
+	for _, expected := range []string{
+		expectedInterfaces,
+		`writeLocationsProcessorClass = require('./fixtures/testdata/writeLocations').default;`,
+		`"config": {"cassandraEndpoints": process.env.CASSANDRA_ENDPOINT} satisfies WriteLocationsConfig`,
+	} {
+		if !strings.Contains(stage, expected) {
+			t.Errorf("stage.ts did not contain -->%s<--: %s", expected, stage)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An environment may declare "extends": "base.json" to start from another
+// environment and override only the fields that differ. Maps such as
+// deployments, connections and processors are merged key by key, a null
+// value deletes the key from the base, and any other value (including
+// arrays) replaces the base value outright.
+const extendsKey = "extends"
+
+// readEnvironmentDefinition reads an environment and every environment it
+// extends, returning the merged document and a source map that points each
+// value at the file that supplied it.
+func readEnvironmentDefinition(environmentPath string) (document interface{}, source *SourceMap, diagnostics Diagnostics) {
+	return readOverlayChain(environmentPath, nil)
+}
+
+func readOverlayChain(definitionPath string, chain []string) (document interface{}, source *SourceMap, diagnostics Diagnostics) {
+	document, source, diagnostics = readDefinition(definitionPath)
+	if diagnostics.HasErrors() {
+		return nil, source, diagnostics
+	}
+
+	overlay, ok := document.(map[string]interface{})
+	if !ok {
+		return document, source, diagnostics
+	}
+
+	extends, ok := overlay[extendsKey]
+	if !ok {
+		return document, source, diagnostics
+	}
+
+	basePath, ok := extends.(string)
+	if !ok || basePath == "" {
+		diagnostics.Errorf(CodeParseError, source, extendsKey, "extends must name the environment file to start from")
+		return nil, source, diagnostics
+	}
+
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(definitionPath), basePath)
+	}
+
+	chain = append(chain, filepath.Clean(definitionPath))
+	for _, visitedPath := range chain {
+		if visitedPath == filepath.Clean(basePath) {
+			diagnostics.Errorf(CodeParseError, source, extendsKey, "environment extends itself: %s -> %s", strings.Join(chain, " -> "), basePath)
+			return nil, source, diagnostics
+		}
+	}
+
+	baseDocument, baseSource, baseDiagnostics := readOverlayChain(basePath, chain)
+	diagnostics = append(diagnostics, baseDiagnostics...)
+	if baseDiagnostics.HasErrors() {
+		return nil, source, diagnostics
+	}
+
+	delete(overlay, extendsKey)
+	source.Remove(extendsKey)
+
+	merged := mergeDocuments(baseDocument, overlay, "", baseSource, source)
+	baseSource.File = source.File
+	baseSource.Overlay(source)
+
+	return merged, baseSource, diagnostics
+}
+
+// mergeDocuments deep merges overlay onto base. Paths that the overlay
+// deletes or replaces are dropped from baseSource, and deletions are dropped
+// from overlaySource, so that the two can then be overlaid.
+func mergeDocuments(base interface{}, overlay interface{}, path string, baseSource *SourceMap, overlaySource *SourceMap) interface{} {
+	baseMap, baseIsMap := base.(map[string]interface{})
+	overlayMap, overlayIsMap := overlay.(map[string]interface{})
+
+	if !baseIsMap || !overlayIsMap {
+		baseSource.recordOverride(path, base)
+		baseSource.Remove(path)
+		return stripNulls(overlay, path, overlaySource)
+	}
+
+	merged := map[string]interface{}{}
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+
+	keys := make([]string, 0, len(overlayMap))
+	for key := range overlayMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := overlayMap[key]
+		memberPath := joinPath(path, key)
+
+		if value == nil {
+			delete(merged, key)
+			baseSource.Remove(memberPath)
+			overlaySource.Remove(memberPath)
+			continue
+		}
+
+		if baseValue, ok := merged[key]; ok {
+			merged[key] = mergeDocuments(baseValue, value, memberPath, baseSource, overlaySource)
+		} else {
+			merged[key] = stripNulls(value, memberPath, overlaySource)
+		}
+	}
+
+	return merged
+}
+
+// stripNulls drops null members from maps, since null only means "delete"
+// and has nothing to delete when there's no base value.
+func stripNulls(value interface{}, path string, source *SourceMap) interface{} {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	stripped := map[string]interface{}{}
+	for key, member := range valueMap {
+		memberPath := joinPath(path, key)
+		if member == nil {
+			source.Remove(memberPath)
+			continue
+		}
+
+		stripped[key] = stripNulls(member, memberPath, source)
+	}
+
+	return stripped
+}
+
+// Overlay copies every position of overlay over the positions of s.
+func (s *SourceMap) Overlay(overlay *SourceMap) {
+	for path, position := range overlay.positions {
+		s.positions[path] = position
+	}
+	for path, overridden := range overlay.overrides {
+		s.overrides[path] = append(s.overrides[path], overridden...)
+	}
+}
+
+// Provenance is a value together with where it was defined.
+type Provenance struct {
+	Value    interface{} `json:"value"`
+	Position Position    `json:"source"`
+}
+
+func (s *SourceMap) recordOverride(path string, value interface{}) {
+	position, ok := s.Lookup(path)
+	if !ok {
+		return
+	}
+
+	s.overrides[path] = append(s.overrides[path], Provenance{Value: value, Position: position})
+}
+
+// Overridden returns the values that overlays replaced at path, oldest first.
+func (s *SourceMap) Overridden(path string) []Provenance {
+	if s == nil {
+		return nil
+	}
+
+	return s.overrides[path]
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadEnvironmentOverlay(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/staging.yaml")
+	environment, err := builder.LoadEnvironment()
+	if err != nil {
+		t.Errorf("LoadEnvironment did not complete successfully: %s", err)
+	}
+
+	if environment.Tier != "staging" {
+		t.Errorf("Tier was not overridden, got %s", environment.Tier)
+	}
+
+	if environment.Namespace != "data-pipeline" {
+		t.Errorf("Namespace was not inherited, got %s", environment.Namespace)
+	}
+
+	locations := environment.Connections["locations"]
+	if locations.Config["endpoint"] != "staging-kafka-endpoint" || locations.Config["topic"] != "locations-topic" {
+		t.Errorf("locations config was not deep merged, got %v", locations.Config)
+	}
+
+	if _, ok := environment.Processors["writeLocations"]; ok {
+		t.Errorf("writeLocations processor config was not deleted")
+	}
+
+	predictArrivals := environment.Deployments["predict-arrivals"]
+	if predictArrivals.CPU.Limit != "500m" || predictArrivals.CPU.Request != "250m" {
+		t.Errorf("predict-arrivals cpu was not deep merged, got %v", predictArrivals.CPU)
+	}
+
+	if environment.Deployments["notify-arrivals"].Replicas.Min != 2 {
+		t.Errorf("notify-arrivals replicas were not overridden")
+	}
+
+	if len(environment.Deployments) != 3 {
+		t.Errorf("Deployments were not inherited, got %d", len(environment.Deployments))
+	}
+
+	position := builder.EnvironmentSource.LocatePosition("deployments.predict-arrivals.cpu.limit")
+	if position.File != "fixtures/overlays/staging.yaml" || position.Line != 20 {
+		t.Errorf("overridden value located at %s:%d", position.File, position.Line)
+	}
+
+	position = builder.EnvironmentSource.LocatePosition("deployments.predict-arrivals.cpu.request")
+	if position.File != "fixtures/environment.json" {
+		t.Errorf("inherited value located in %s", position.File)
+	}
+}
+
+func TestLoadEnvironmentOverlayCycle(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/loop-a.json")
+	_, err := builder.LoadEnvironment()
+	if err == nil {
+		t.Errorf("LoadEnvironment should fail when environments extend one another")
+	}
+
+	if !strings.Contains(err.Error(), "environment extends itself") {
+		t.Errorf("unexpected error for extends cycle: %s", err)
+	}
+}
@@ -1,5 +1,88 @@
 package main
 
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// PlatformBuilder generates the code of one deployment for the runtime its
+// processors are written for.
 type PlatformBuilder interface {
+	// Validate reports problems specific to the platform, e.g. processor
+	// files it cannot load.
+	Validate() (diagnostics Diagnostics)
+
+	// BuildSource writes the stage code of the deployment to its directory.
 	BuildSource() (err error)
+
+	// Image describes how the generated stage is installed and run.
+	Image() PlatformImage
+
+	// Dependencies lists the packages the stage needs, by name and version.
+	Dependencies() (dependencies map[string]string)
+}
+
+// PlatformImage describes how the stage code of a platform is packaged and
+// run, from the directory BuildSource writes it to. Build compiles the stage
+// after Install, for platforms that need it.
+type PlatformImage struct {
+	Dockerfile string   `json:"dockerfile,omitempty"`
+	Install    []string `json:"install,omitempty"`
+	Build      []string `json:"build,omitempty"`
+	Command    []string `json:"command,omitempty"`
+}
+
+// processorCopyPath is where under the processors directory of a stage a
+// local processor file or package is copied to: its path next to the
+// topology, e.g. a/aggregate for ./a/aggregate, without the ../ that lead
+// out of it.
+func processorCopyPath(processorPath string) string {
+	copyPath := path.Clean(processorPath)
+	for strings.HasPrefix(copyPath, "../") {
+		copyPath = strings.TrimPrefix(copyPath, "../")
+	}
+
+	return copyPath
+}
+
+// PlatformContext is everything a platform builder knows about the
+// deployment it builds. Problems that do not stop the build are appended to
+// Diagnostics, when set.
+type PlatformContext struct {
+	DeploymentID string
+	Deployment   Deployment
+	Topology     Topology
+	Environment  Environment
+
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+	Diagnostics       *Diagnostics
+}
+
+type PlatformBuilderFactory func(context PlatformContext) PlatformBuilder
+
+var platformBuilders = map[string]PlatformBuilderFactory{}
+
+// RegisterPlatformBuilder makes a platform available to deployments whose
+// processors declare it. Platforms register themselves from init.
+func RegisterPlatformBuilder(platform string, factory PlatformBuilderFactory) {
+	platformBuilders[platform] = factory
+}
+
+// RegisteredPlatforms lists the names of the registered platforms, sorted.
+func RegisteredPlatforms() []string {
+	platforms := make([]string, 0, len(platformBuilders))
+	for platform := range platformBuilders {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	return platforms
+}
+
+func unknownPlatformError(platform string, deploymentID string) error {
+	var diagnostics Diagnostics
+	diagnostics.Errorf(CodeUnknownPlatform, nil, "", "unknown platform %s for deployment %s, expected one of %s or a %s%s plugin", platform, deploymentID, strings.Join(RegisteredPlatforms(), ", "), pluginPrefix, platform)
+	return diagnostics
 }
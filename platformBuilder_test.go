@@ -0,0 +1,185 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRegisteredPlatforms(t *testing.T) {
+	platforms := RegisteredPlatforms()
+	expectedPlatforms := "go, node.js, python"
+	if strings.Join(platforms, ", ") != expectedPlatforms {
+		t.Errorf("platforms did not match:-->%s<-- vs. -->%s<--", strings.Join(platforms, ", "), expectedPlatforms)
+	}
+}
+
+func TestMakeBuilderUnknownPlatform(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	for nodeId, node := range builder.Topology.Nodes {
+		node.Processor.Platform = "cobol"
+		builder.Topology.Nodes[nodeId] = node
+	}
+
+	_, err = builder.MakeBuilder("write-locations")
+	if err == nil {
+		t.Fatalf("expected an error for an unknown platform")
+	}
+
+	expectedError := "unknown platform cobol for deployment write-locations, expected one of " + strings.Join(RegisteredPlatforms(), ", ") + " or a topo-platform-cobol plugin"
+	if err.Error() != expectedError {
+		t.Errorf("error did not match:-->%s<-- vs. -->%s<--", err.Error(), expectedError)
+	}
+
+	diagnostics := builder.validatePlatforms()
+	if !diagnostics.HasCode(CodeUnknownPlatform) {
+		t.Errorf("expected an unknown-platform diagnostic, got: %s", diagnostics)
+	}
+}
+
+func TestNodeJsPlatformBuilderValidate(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	node := builder.Topology.Nodes["writeLocations"]
+	node.Processor.File = "./processors/writeLocations.py"
+	builder.Topology.Nodes["writeLocations"] = node
+
+	platformBuilder, err := builder.MakeBuilder("write-locations")
+	if err != nil {
+		t.Fatalf("failed to make builder: %s", err)
+	}
+
+	diagnostics := platformBuilder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeInvalidProcessor) {
+		t.Errorf("expected one invalid-processor diagnostic, got: %s", diagnostics)
+	}
+}
+
+// loadPlatformBuilder loads a topology and environment and makes the
+// platform builder of one deployment, moving its nodes to platform first
+// when one is given.
+func loadPlatformBuilder(t *testing.T, topologyFile string, environmentFile string, deploymentID string, platform string) (*Builder, PlatformBuilder) {
+	builder := NewBuilder(topologyFile, environmentFile)
+	err := builder.Load()
+	if err != nil {
+		t.Fatalf("builder failed to load: %s", err)
+	}
+
+	if platform != "" {
+		for _, nodeID := range builder.Environment.Deployments[deploymentID].Nodes {
+			node := builder.Topology.Nodes[nodeID]
+			node.Processor.Platform = platform
+			builder.Topology.Nodes[nodeID] = node
+		}
+	}
+
+	platformBuilder, err := builder.MakeBuilder(deploymentID)
+	if err != nil {
+		t.Fatalf("failed to make builder: %s", err)
+	}
+
+	return builder, platformBuilder
+}
+
+func TestPluginValidate(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+
+	diagnostics := platformBuilder.Validate()
+
+	expectedDiagnostics := `fixtures/topology.json:7:17 nodes.writeLocations.processor.platform: the shell platform is for tests only`
+	if len(diagnostics) != 1 || diagnostics[0].String() != expectedDiagnostics || diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("diagnostics did not match:-->%v<-- vs. -->%s<--", diagnostics, expectedDiagnostics)
+	}
+}
+
+func TestPluginDescribe(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+
+	image := platformBuilder.Image()
+	if strings.Join(image.Command, " ") != "sh stage.sh" {
+		t.Errorf("image command did not match:-->%s<--", image.Command)
+	}
+
+	dependencies := platformBuilder.Dependencies()
+	if len(dependencies) != 1 || dependencies["busybox"] != "1.36" {
+		t.Errorf("expected busybox dependency, got: %v", dependencies)
+	}
+}
+
+func TestPluginBuildSource(t *testing.T) {
+	builder, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+
+	deploymentPath := path.Join("build", builder.Environment.Tier, "write-locations")
+	os.RemoveAll(deploymentPath)
+	if err := os.MkdirAll(deploymentPath, 0755); err != nil {
+		t.Fatalf("failed to create deployment directory: %s", err)
+	}
+	defer os.RemoveAll(deploymentPath)
+
+	if err := platformBuilder.BuildSource(); err != nil {
+		t.Fatalf("plugin build failed: %s", err)
+	}
+
+	expectedFiles := map[string]string{
+		"Dockerfile": "FROM alpine\n",
+		"stage.sh":   "echo write-locations\n",
+	}
+	for fileName, expectedContent := range expectedFiles {
+		content, err := ioutil.ReadFile(path.Join(deploymentPath, fileName))
+		if err != nil {
+			t.Errorf("could not read %s: %s", fileName, err)
+		}
+		if string(content) != expectedContent {
+			t.Errorf("%s did not match:-->%s<-- vs. -->%s<--", fileName, content, expectedContent)
+		}
+	}
+
+	if !builder.Diagnostics.HasCode("untested-stage") {
+		t.Errorf("expected the plugin's info to be reported with the builder, got: %s", builder.Diagnostics)
+	}
+}
+
+func TestPluginFailure(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+	platformBuilder.(*PluginPlatformBuilder).PluginPath = "fixtures/.topo/plugins/missing"
+
+	diagnostics := platformBuilder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodePluginError) {
+		t.Errorf("expected a plugin-error diagnostic, got: %s", diagnostics)
+	}
+}
+
+func TestPluginDescribeFailure(t *testing.T) {
+	builder, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+	platformBuilder.(*PluginPlatformBuilder).PluginPath = "fixtures/.topo/plugins/missing"
+
+	image := platformBuilder.Image()
+	if platformBuilder.(*PluginPlatformBuilder).describeErr == nil || !builder.Diagnostics.HasCode(CodePluginError) {
+		t.Errorf("expected the describe failure to be kept and reported, got: %s", builder.Diagnostics)
+	}
+
+	if err := builder.BuildSystemd("write-locations", image); err == nil {
+		t.Errorf("BuildSystemd should fail without a command to run")
+	}
+}
+
+func TestPluginBuildFailure(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/topology.json", "fixtures/environment.json", "write-locations", "shell")
+	platformBuilder.(*PluginPlatformBuilder).PluginPath = "fixtures/.topo/plugins/missing"
+
+	diagnostics, ok := platformBuilder.BuildSource().(Diagnostics)
+	if !ok || len(diagnostics) != 1 || !diagnostics.HasCode(CodePluginError) {
+		t.Errorf("expected a plugin-error diagnostic, got: %v", diagnostics)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Platforms that are not built in are provided by executables named
+// topo-platform-<platform>, found in the project's plugin directory next to
+// the topology definition or on PATH.
+const (
+	pluginPrefix          = "topo-platform-"
+	pluginProjectDir      = ".topo/plugins"
+	pluginProtocolVersion = 1
+)
+
+// Commands a plugin is asked to run, one per invocation.
+const (
+	PluginCommandValidate = "validate"
+	PluginCommandDescribe = "describe"
+	PluginCommandBuild    = "build"
+)
+
+// PluginRequest is written as JSON to the plugin's stdin. It holds the
+// resolved model of one deployment: only its own nodes, the connections they
+// use, the processor envs of those nodes and the environment variables the
+// stage reads.
+type PluginRequest struct {
+	Version      int                     `json:"version"`
+	Command      string                  `json:"command"`
+	Platform     string                  `json:"platform"`
+	Topology     string                  `json:"topology"`
+	Tier         string                  `json:"tier"`
+	DeploymentID string                  `json:"deploymentId"`
+	Deployment   Deployment              `json:"deployment"`
+	Nodes        map[string]Node         `json:"nodes"`
+	Connections  map[string]Connection   `json:"connections"`
+	Processors   map[string]ProcessorEnv `json:"processors"`
+	Env          []EnvRequirement        `json:"env"`
+}
+
+// PluginResponse is read as JSON from the plugin's stdout. Files are written
+// relative to the deployment's directory by build; image and dependencies
+// answer describe and build; diagnostics may come back from any command.
+// Error reports that the plugin could not run the command at all.
+type PluginResponse struct {
+	Files        []PluginFile       `json:"files,omitempty"`
+	Image        PlatformImage      `json:"image"`
+	Dependencies map[string]string  `json:"dependencies,omitempty"`
+	Diagnostics  []PluginDiagnostic `json:"diagnostics,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+type PluginFile struct {
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	Executable bool   `json:"executable,omitempty"`
+}
+
+// PluginDiagnostic is a problem found by a plugin. Source is "topology" or
+// "environment" and Path a path into that definition, which topo resolves
+// to a line and column.
+type PluginDiagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Source   string `json:"source,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+// findPlatformPlugin looks for the executable of a platform in the project's
+// plugin directory first and then on PATH.
+func findPlatformPlugin(platform string, projectDir string) (pluginPath string, ok bool) {
+	if platform == "" || strings.ContainsAny(platform, `/\`) {
+		return "", false
+	}
+
+	name := pluginPrefix + platform
+
+	projectPath := path.Join(projectDir, pluginProjectDir, name)
+	if info, err := os.Stat(projectPath); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+		return projectPath, true
+	}
+
+	pluginPath, err := exec.LookPath(name)
+	if err != nil {
+		return "", false
+	}
+
+	return pluginPath, true
+}
+
+func pluginPlatformBuilderFactory(platform string, pluginPath string) PlatformBuilderFactory {
+	return func(context PlatformContext) PlatformBuilder {
+		return &PluginPlatformBuilder{
+			Platform:   platform,
+			PluginPath: pluginPath,
+			Context:    context,
+		}
+	}
+}
+
+// PluginPlatformBuilder builds a deployment by running an external
+// topo-platform-<platform> executable.
+type PluginPlatformBuilder struct {
+	Platform   string
+	PluginPath string
+	Context    PlatformContext
+
+	DeploymentPath string
+
+	described   *PluginResponse
+	describeErr error
+}
+
+func (b *PluginPlatformBuilder) request(command string) PluginRequest {
+	context := b.Context
+
+	nodes := map[string]Node{}
+	processors := map[string]ProcessorEnv{}
+	for _, nodeId := range context.Deployment.Nodes {
+		nodes[nodeId] = context.Topology.Nodes[nodeId]
+		if processor, ok := context.Environment.Processors[nodeId]; ok {
+			processors[nodeId] = processor
+		}
+	}
+
+	connections := map[string]Connection{}
+	for _, connectionId := range deploymentConnections(context.Deployment, context.Topology) {
+		connections[connectionId] = context.Environment.Connections[connectionId]
+	}
+
+	return PluginRequest{
+		Version:      pluginProtocolVersion,
+		Command:      command,
+		Platform:     b.Platform,
+		Topology:     context.Topology.Name,
+		Tier:         context.Environment.Tier,
+		DeploymentID: context.DeploymentID,
+		Deployment:   context.Deployment,
+		Nodes:        nodes,
+		Connections:  connections,
+		Processors:   processors,
+		Env:          collectEnvRequirements(context.Deployment, context.Topology, context.Environment),
+	}
+}
+
+// run sends a command to the plugin and decodes its response. Failing to
+// run the plugin, or a response carrying an error, is returned as err.
+func (b *PluginPlatformBuilder) run(command string) (response PluginResponse, err error) {
+	requestJSON, err := json.Marshal(b.request(command))
+	if err != nil {
+		return response, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(b.PluginPath)
+	cmd.Stdin = bytes.NewReader(requestJSON)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return response, errors.New(fmt.Sprintf("platform plugin %s failed to %s deployment %s: %s", b.PluginPath, command, b.Context.DeploymentID, message))
+	}
+
+	if err = json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return response, errors.New(fmt.Sprintf("platform plugin %s returned an invalid response to %s: %s", b.PluginPath, command, err))
+	}
+
+	if response.Error != "" {
+		return response, errors.New(fmt.Sprintf("platform plugin %s failed to %s deployment %s: %s", b.PluginPath, command, b.Context.DeploymentID, response.Error))
+	}
+
+	return response, nil
+}
+
+// diagnostics converts the diagnostics of a response, locating them in the
+// definition they refer to.
+func (b *PluginPlatformBuilder) diagnostics(response PluginResponse) (diagnostics Diagnostics) {
+	for _, pluginDiagnostic := range response.Diagnostics {
+		var source *SourceMap
+		switch pluginDiagnostic.Source {
+		case "topology":
+			source = b.Context.TopologySource
+		case "environment":
+			source = b.Context.EnvironmentSource
+		}
+
+		severity := SeverityError
+		switch pluginDiagnostic.Severity {
+		case "warning":
+			severity = SeverityWarning
+		case "info":
+			severity = SeverityInfo
+		}
+
+		code := pluginDiagnostic.Code
+		if code == "" {
+			code = CodePluginError
+		}
+
+		diagnostics.Add(severity, code, source, pluginDiagnostic.Path, pluginDiagnostic.Message)
+	}
+
+	return diagnostics
+}
+
+func (b *PluginPlatformBuilder) Validate() (diagnostics Diagnostics) {
+	response, err := b.run(PluginCommandValidate)
+	if err != nil {
+		diagnostics.Errorf(CodePluginError, nil, "", "%s", err)
+	}
+
+	return append(diagnostics, b.diagnostics(response)...)
+}
+
+// report records diagnostics that do not stop the build with the builder
+// of the deployment.
+func (b *PluginPlatformBuilder) report(diagnostics Diagnostics) {
+	if b.Context.Diagnostics != nil {
+		*b.Context.Diagnostics = append(*b.Context.Diagnostics, diagnostics...)
+	}
+}
+
+// describe asks the plugin for the image and dependencies of the deployment
+// once. A failure is kept in describeErr and reported, leaving both empty.
+func (b *PluginPlatformBuilder) describe() PluginResponse {
+	if b.described == nil {
+		response, err := b.run(PluginCommandDescribe)
+		b.described = &response
+
+		var diagnostics Diagnostics
+		if err != nil {
+			b.describeErr = err
+			diagnostics.Errorf(CodePluginError, nil, "", "%s", err)
+		}
+		b.report(append(diagnostics, b.diagnostics(response)...))
+	}
+
+	return *b.described
+}
+
+// Image is the image the plugin described in its build response, or asks
+// for it with describe when the deployment has not been built.
+func (b *PluginPlatformBuilder) Image() PlatformImage {
+	return b.describe().Image
+}
+
+func (b *PluginPlatformBuilder) Dependencies() (dependencies map[string]string) {
+	return b.describe().Dependencies
+}
+
+// BuildSource writes the files the plugin returns to the deployment's
+// directory, after the Dockerfile of its image. Error diagnostics from the
+// plugin fail the build and are returned as Diagnostics along with the rest,
+// which are otherwise reported with the builder of the deployment.
+func (b *PluginPlatformBuilder) BuildSource() (err error) {
+	b.DeploymentPath = path.Join("build", b.Context.Environment.Tier, b.Context.DeploymentID)
+
+	response, err := b.run(PluginCommandBuild)
+	if err != nil {
+		var diagnostics Diagnostics
+		diagnostics.Errorf(CodePluginError, nil, "", "%s", err)
+		return diagnostics
+	}
+	b.described = &response
+
+	diagnostics := b.diagnostics(response)
+	if diagnostics.HasErrors() {
+		return diagnostics
+	}
+	b.report(diagnostics)
+
+	if response.Image.Dockerfile != "" {
+		if err = ioutil.WriteFile(path.Join(b.DeploymentPath, "Dockerfile"), []byte(response.Image.Dockerfile), 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range response.Files {
+		filePath := filepath.ToSlash(filepath.Clean(file.Path))
+		if filepath.IsAbs(file.Path) || filePath == ".." || strings.HasPrefix(filePath, "../") {
+			return errors.New(fmt.Sprintf("platform plugin %s returned file %s outside of deployment %s", b.PluginPath, file.Path, b.Context.DeploymentID))
+		}
+
+		if err = os.MkdirAll(path.Dir(path.Join(b.DeploymentPath, filePath)), 0755); err != nil {
+			return err
+		}
+
+		var mode os.FileMode = 0644
+		if file.Executable {
+			mode = 0755
+		}
+
+		if err = ioutil.WriteFile(path.Join(b.DeploymentPath, filePath), []byte(file.Content), mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
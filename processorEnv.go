@@ -1,5 +1,5 @@
 package main
 
 type ProcessorEnv struct {
-	Config map[string]interface{}
+	Config map[string]interface{} `json:"config,omitempty"`
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// moduleExtensions are tried, in order, for require and import specifiers
+// without one, as node and tsc resolve them.
+var moduleExtensions = []string{".js", ".ts", ".json"}
+
+// moduleSpecifiers find the specifiers of require calls, dynamic imports,
+// and import and export ... from statements. The first group is the
+// statement keyword, used to skip type only imports that tsc erases.
+var moduleSpecifiers = []*regexp.Regexp{
+	regexp.MustCompile(`()\brequire\s*\(\s*['"]([^'"]+)['"]\s*\)`),
+	regexp.MustCompile(`()\bimport\s*\(\s*['"]([^'"]+)['"]\s*\)`),
+	regexp.MustCompile(`(?m)^\s*((?:import|export)(?:\s+type)?)\s+(?:[^'";]*?\s+from\s+)?['"]([^'"]+)['"]`),
+}
+
+// MissingImport is a local module a processor file requires or imports that
+// does not exist.
+type MissingImport struct {
+	File      string
+	Specifier string
+}
+
+func isFile(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && !info.IsDir()
+}
+
+// resolveModule resolves a module path the way require does: the file
+// itself, with one of moduleExtensions, or a directory's package.json main or
+// index. The files that make up the resolution are returned, the entry
+// first, followed by the package.json that names it.
+func resolveModule(modulePath string) (files []string, ok bool) {
+	modulePath = path.Clean(modulePath)
+
+	if isFile(modulePath) {
+		return []string{modulePath}, true
+	}
+
+	for _, extension := range moduleExtensions {
+		if isFile(modulePath + extension) {
+			return []string{modulePath + extension}, true
+		}
+	}
+
+	packageJsonPath := path.Join(modulePath, "package.json")
+	if packageJsonBytes, err := ioutil.ReadFile(packageJsonPath); err == nil {
+		var packageJson struct {
+			Main string
+		}
+		if json.Unmarshal(packageJsonBytes, &packageJson) == nil && packageJson.Main != "" {
+			if mainFiles, ok := resolveModule(path.Join(modulePath, packageJson.Main)); ok {
+				return append(mainFiles, packageJsonPath), true
+			}
+		}
+	}
+
+	for _, extension := range moduleExtensions[:2] {
+		if indexPath := path.Join(modulePath, "index"+extension); isFile(indexPath) {
+			return []string{indexPath}, true
+		}
+	}
+
+	return nil, false
+}
+
+func isLocalSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../")
+}
+
+// localImports lists the local specifiers a JavaScript or TypeScript file
+// requires or imports, leaving out packages and type only imports.
+func localImports(source string) (specifiers []string) {
+	for _, pattern := range moduleSpecifiers {
+		for _, match := range pattern.FindAllStringSubmatch(source, -1) {
+			if strings.HasSuffix(match[1], "type") {
+				continue
+			}
+			if isLocalSpecifier(match[2]) {
+				specifiers = append(specifiers, match[2])
+			}
+		}
+	}
+
+	return specifiers
+}
+
+// collectProcessorModules scans a processor module and, transitively, the
+// local modules it requires or imports. It returns every file the processor
+// needs, relative to the working directory like the processor file, and the
+// local imports that could not be resolved.
+func collectProcessorModules(processorFile string) (files []string, missing []MissingImport) {
+	entryFiles, ok := resolveModule(processorFile)
+	if !ok {
+		return nil, []MissingImport{{Specifier: processorFile}}
+	}
+
+	collected := map[string]bool{}
+	queue := []string{}
+	for _, file := range entryFiles {
+		collected[file] = true
+		queue = append(queue, file)
+	}
+
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+
+		if path.Ext(file) == ".json" {
+			continue
+		}
+
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			missing = append(missing, MissingImport{Specifier: file})
+			continue
+		}
+
+		for _, specifier := range localImports(string(source)) {
+			resolvedFiles, ok := resolveModule(path.Join(path.Dir(file), specifier))
+			if !ok {
+				missing = append(missing, MissingImport{File: file, Specifier: specifier})
+				continue
+			}
+
+			for _, resolvedFile := range resolvedFiles {
+				if !collected[resolvedFile] {
+					collected[resolvedFile] = true
+					queue = append(queue, resolvedFile)
+				}
+			}
+		}
+	}
+
+	return sortedKeys(collected), missing
+}
+
+// processorEntry is the file a processor module resolves to, which decides
+// whether it is JavaScript or TypeScript.
+func processorEntry(processorFile string) string {
+	files, ok := resolveModule(processorFile)
+	if !ok {
+		return processorFile
+	}
+
+	return files[0]
+}
+
+// moduleRoots lists the top level directories of a set of files, which
+// tsconfig.json includes.
+func moduleRoots(files []string) []string {
+	roots := map[string]bool{}
+	for _, file := range files {
+		roots[strings.Split(file, "/")[0]] = true
+	}
+
+	return sortedKeys(roots)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalImports(t *testing.T) {
+	source := `import { Processor } from 'topological';
+import type { WriteLocationsConfig } from '../stage';
+import geo from "./lib/geo";
+export * from './lib/units';
+const bounds = require('./lib/bounds.json'),
+    fetch = require('node-fetch');
+const lazy = () => import('../shared/lazy');`
+
+	specifiers := localImports(source)
+
+	expectedSpecifiers := "./lib/bounds.json, ../shared/lazy, ./lib/geo, ./lib/units"
+	if strings.Join(specifiers, ", ") != expectedSpecifiers {
+		t.Errorf("specifiers did not match:-->%s<-- vs. -->%s<--", strings.Join(specifiers, ", "), expectedSpecifiers)
+	}
+}
+
+func TestCollectProcessorModules(t *testing.T) {
+	modules := map[string]string{
+		"./fixtures/testdata/enrichLocations": "fixtures/testdata/enrichLocations/index.js, fixtures/testdata/enrichLocations/lib/bounds.json, fixtures/testdata/enrichLocations/lib/geo.js",
+		"./fixtures/testdata/filterLocations": "fixtures/testdata/filterLocations/filter.js, fixtures/testdata/filterLocations/lib/geo.js, fixtures/testdata/filterLocations/package.json",
+		"./processors/writeLocations.js":      "processors/writeLocations.js",
+	}
+
+	for processorFile, expectedFiles := range modules {
+		files, missing := collectProcessorModules(processorFile)
+		if len(missing) != 0 {
+			t.Errorf("expected no missing imports for %s, got: %v", processorFile, missing)
+		}
+		if strings.Join(files, ", ") != expectedFiles {
+			t.Errorf("files of %s did not match:-->%s<-- vs. -->%s<--", processorFile, strings.Join(files, ", "), expectedFiles)
+		}
+	}
+}
+
+func TestValidateMissingImports(t *testing.T) {
+	builder := NewBuilder("fixtures/modules-topology.json", "fixtures/modules-environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	if diagnostics := builder.Validate(); diagnostics.HasErrors() {
+		t.Errorf("expected no errors with module fixtures, got: %v", diagnostics)
+	}
+
+	node := builder.Topology.Nodes["enrichLocations"]
+	node.Processor.File = "./fixtures/testdata/brokenLocations.js"
+	builder.Topology.Nodes["enrichLocations"] = node
+
+	platformBuilder, err := builder.MakeBuilder("enrich-locations")
+	if err != nil {
+		t.Fatalf("failed to make builder: %s", err)
+	}
+
+	diagnostics := platformBuilder.Validate()
+
+	expectedDiagnostic := `fixtures/modules-topology.json:16:17 nodes.enrichLocations.processor.file: ./lib/missing imported by fixtures/testdata/brokenLocations.js of node "enrichLocations" does not exist`
+	if len(diagnostics) != 1 || diagnostics[0].String() != expectedDiagnostic || diagnostics[0].Code != CodeMissingImport {
+		t.Errorf("diagnostics did not match:-->%v<-- vs. -->%s<--", diagnostics, expectedDiagnostic)
+	}
+}
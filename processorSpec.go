@@ -1,7 +1,7 @@
 package main
 
 type ProcessorSpec struct {
-	File         string
-	Platform     string
-	Dependencies map[string]string
+	File         string            `json:"file"`
+	Platform     string            `json:"platform"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
 }
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const pythonPlatform = "python"
+
+type PythonPlatformBuilder struct {
+	DeploymentID string
+	Deployment   Deployment
+	Topology     Topology
+	Environment  Environment
+
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+
+	DeploymentPath string
+	CodePath       string
+	ProcessorPath  string
+}
+
+func init() {
+	RegisterPlatformBuilder(pythonPlatform, func(context PlatformContext) PlatformBuilder {
+		return &PythonPlatformBuilder{
+			DeploymentID:      context.DeploymentID,
+			Deployment:        context.Deployment,
+			Topology:          context.Topology,
+			Environment:       context.Environment,
+			TopologySource:    context.TopologySource,
+			EnvironmentSource: context.EnvironmentSource,
+		}
+	})
+}
+
+const pythonDockerFile = `FROM python:3.11-slim
+
+WORKDIR /app
+
+COPY requirements.txt .
+RUN pip install --no-cache-dir -r requirements.txt
+
+COPY . .
+
+EXPOSE 80
+
+CMD [ "./start-stage" ]
+`
+
+const pythonStartStage = `#!/bin/bash
+
+export PORT=80
+
+exec python stage.py
+`
+
+// pythonRequirements are the packages every generated stage.py imports.
+var pythonRequirements = map[string]string{
+	"prometheus-client": ">=0.17",
+	"topological":       ">=1.0",
+}
+
+// processors are imported as modules of the processors package by their
+// path, so their file names and directories must be Python identifiers.
+var pythonModuleFile = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*/)*[A-Za-z_][A-Za-z0-9_]*\.py$`)
+
+// pythonProcessorModule is the dotted path a processor file is imported
+// from, e.g. processors.a.score for ./a/score.py.
+func pythonProcessorModule(file string) string {
+	return "processors." + strings.Replace(strings.TrimSuffix(processorCopyPath(file), ".py"), "/", ".", -1)
+}
+
+// pythonModuleName is the module a package is imported as, e.g.
+// topological_kafka for topological-kafka.
+func pythonModuleName(packageName string) string {
+	return strings.ToLower(strings.Replace(packageName, "-", "_", -1))
+}
+
+// pythonSpecifiers matches versions that already are pip version
+// specifiers, such as >=1.2 or ~=1.26,!=1.26.3.
+var pythonSpecifiers = regexp.MustCompile(`^(===|==|!=|~=|<=|>=|<|>)\s*[0-9][0-9A-Za-z.*+!-]*(\s*,\s*(===|==|!=|~=|<=|>=|<|>)\s*[0-9][0-9A-Za-z.*+!-]*)*$`)
+
+var pythonBareVersion = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// pythonRequirement renders a requirements.txt line. Versions that are
+// already specifiers such as >=1.2 are kept, bare versions are pinned and
+// empty or * versions leave the package unpinned. npm ranges such as ^1.0.4
+// are translated, e.g. to >=1.0.4,<2.0.0, unless they are a union of ranges
+// that pip cannot express.
+func pythonRequirement(packageName string, version string) (requirement string, err error) {
+	version = strings.TrimSpace(version)
+	switch {
+	case version == "" || version == "*":
+		return packageName, nil
+	case pythonSpecifiers.MatchString(version):
+		return packageName + version, nil
+	case pythonBareVersion.MatchString(version):
+		return packageName + "==" + version, nil
+	}
+
+	semVerRange, err := ParseSemVerRange(version)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("version %q of %s is neither a pip specifier nor an npm range: %s", version, packageName, err))
+	}
+	if len(semVerRange) > 1 {
+		return "", errors.New(fmt.Sprintf("version %q of %s allows several ranges, which pip cannot express", version, packageName))
+	}
+
+	interval := semVerRange[0]
+	if interval.Lower.Set && interval.Upper.Set && interval.Lower.Inclusive && interval.Upper.Inclusive && interval.Lower.Version.Compare(interval.Upper.Version) == 0 {
+		return packageName + "==" + interval.Lower.Version.String(), nil
+	}
+
+	specifiers := []string{}
+	for _, comparator := range strings.Fields(interval.String()) {
+		if comparator != "*" {
+			specifiers = append(specifiers, comparator)
+		}
+	}
+
+	return packageName + strings.Join(specifiers, ","), nil
+}
+
+// Validate checks that the connections of the deployment are Python
+// packages, that its processors are modules the stage can import and that
+// pip can install a version of every package that all of them agree on.
+func (b *PythonPlatformBuilder) Validate() (diagnostics Diagnostics) {
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		platform := b.Environment.Connections[connectionId].Platform
+		if platform != "" && platform != pythonPlatform {
+			diagnostics.Errorf(CodeMismatchedPlatform, b.EnvironmentSource, joinPath(joinPath("connections", connectionId), "platform"), "connection %q is built for platform %s, but deployment %q runs %s", connectionId, platform, b.DeploymentID, pythonPlatform)
+		}
+	}
+
+	for _, nodeId := range b.Deployment.Nodes {
+		file := b.Topology.Nodes[nodeId].Processor.File
+		if !pythonModuleFile.MatchString(processorCopyPath(file)) {
+			diagnostics.Errorf(CodeInvalidProcessor, b.TopologySource, joinPath(joinPath("nodes", nodeId), "processor.file"), "processor file %s of node %q is not an importable Python module", file, nodeId)
+		}
+	}
+
+	resolved := b.resolvedDependencies()
+	for _, dependency := range resolved {
+		packageName := dependency.Name
+		for _, request := range dependency.RequestedBy {
+			if _, err := pythonRequirement(packageName, request.Range); err != nil {
+				if request.Kind == "connection" {
+					diagnostics.Errorf(CodeInvalidDependency, b.EnvironmentSource, joinPath(joinPath(joinPath("connections", request.ID), "dependencies"), packageName), "%s", err)
+				} else {
+					diagnostics.Errorf(CodeInvalidDependency, b.TopologySource, joinPath(joinPath(joinPath("nodes", request.ID), "processor.dependencies"), packageName), "%s", err)
+				}
+			}
+		}
+	}
+
+	return append(diagnostics, dependencyConflicts(resolved, b.TopologySource, b.EnvironmentSource)...)
+}
+
+func (b *PythonPlatformBuilder) Image() PlatformImage {
+	return PlatformImage{
+		Dockerfile: pythonDockerFile,
+		Install:    []string{"python3", "-m", "pip", "install", "-r", "requirements.txt"},
+		Command:    []string{"python3", "stage.py"},
+	}
+}
+
+// resolvedDependencies resolves the pip versions that the processors of the
+// deployment and the connections they use ask for.
+func (b *PythonPlatformBuilder) resolvedDependencies() []ResolvedDependency {
+	return resolveDependencies(collectDependencies(b.Deployment.Nodes, b.Topology, b.Environment))
+}
+
+// Dependencies maps every package to the version that satisfies all of its
+// requesters. Conflicting packages, which Validate reports, keep the version
+// of their last requester.
+func (b *PythonPlatformBuilder) Dependencies() (dependencies map[string]string) {
+	return dependencyVersions(b.resolvedDependencies())
+}
+
+func (b *PythonPlatformBuilder) FillRequirementsTxt() (requirementsTxt string) {
+	dependencies := b.Dependencies()
+	for packageName, version := range pythonRequirements {
+		if _, ok := dependencies[packageName]; !ok {
+			dependencies[packageName] = version
+		}
+	}
+
+	requirements := []string{}
+	for packageName, version := range dependencies {
+		// Validate reports the versions pip cannot take
+		if requirement, err := pythonRequirement(packageName, version); err == nil {
+			requirements = append(requirements, requirement)
+		}
+	}
+
+	sort.Strings(requirements)
+
+	return strings.Join(requirements, "\n") + "\n"
+}
+
+// FillImports imports the Connection class of the packages of every
+// connection and the Processor class of every processor module.
+func (b *PythonPlatformBuilder) FillImports() (imports string) {
+	connectionImports := []string{}
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		for packageName := range b.Environment.Connections[connectionId].Dependencies {
+			connectionImports = append(connectionImports, fmt.Sprintf(`from %s import Connection as %sConnectionClass`, pythonModuleName(packageName), connectionId))
+		}
+	}
+
+	sort.Strings(connectionImports)
+
+	processorImports := []string{}
+	for _, nodeId := range b.Deployment.Nodes {
+		moduleName := pythonProcessorModule(b.Topology.Nodes[nodeId].Processor.File)
+		processorImports = append(processorImports, fmt.Sprintf(`from %s import Processor as %sProcessorClass`, moduleName, nodeId))
+	}
+
+	return fmt.Sprintf(`import os
+import sys
+
+from prometheus_client import start_http_server
+from topological import Node, Topology
+
+%s
+%s`, strings.Join(connectionImports, "\n"), strings.Join(processorImports, "\n"))
+}
+
+func (b *PythonPlatformBuilder) buildConfig(config map[string]interface{}) (configPython string) {
+	values, err := ParseConfig(config)
+	if err != nil {
+		// config is validated before any code is generated
+		return "None"
+	}
+
+	return pythonDict(values)
+}
+
+func (b *PythonPlatformBuilder) FillConnections() (connectionInstantiations string) {
+	instantiations := []string{}
+
+	for _, connectionId := range deploymentConnections(b.Deployment, b.Topology) {
+		connectionConfig := b.buildConfig(b.Environment.Connections[connectionId].Config)
+		instantiations = append(instantiations, fmt.Sprintf(`%sConnection = %sConnectionClass({
+    "id": "%s",
+    "config": %s
+})`, connectionId, connectionId, connectionId, connectionConfig))
+	}
+
+	return strings.Join(instantiations, "\n\n")
+}
+
+func (b *PythonPlatformBuilder) FillProcessors() (processorInstantiations string) {
+	instantiations := []string{}
+
+	for _, nodeID := range b.Deployment.Nodes {
+		processorConfig := b.buildConfig(b.Environment.Processors[nodeID].Config)
+		instantiations = append(instantiations, fmt.Sprintf(`%sProcessor = %sProcessorClass({
+    "id": "%s",
+    "config": %s
+})`, nodeID, nodeID, nodeID, processorConfig))
+	}
+
+	sort.Strings(instantiations)
+
+	return strings.Join(instantiations, "\n\n")
+}
+
+// CopyProcessors copies the processor files into the processors package of
+// the stage at their paths next to the topology, making every directory on
+// the way a package with an __init__.py.
+func (b *PythonPlatformBuilder) CopyProcessors() (err error) {
+	for _, nodeId := range b.Deployment.Nodes {
+		file := b.Topology.Nodes[nodeId].Processor.File
+		destPath := path.Join(b.ProcessorPath, processorCopyPath(file))
+		if err = os.MkdirAll(path.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		for dir := path.Dir(destPath); strings.HasPrefix(dir, b.ProcessorPath); dir = path.Dir(dir) {
+			initPath := path.Join(dir, "__init__.py")
+			if _, err = os.Stat(initPath); os.IsNotExist(err) {
+				if err = ioutil.WriteFile(initPath, []byte{}, 0644); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err = CopyFile(file, destPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *PythonPlatformBuilder) FillTopology() (topologyInstantiation string) {
+	nodes := []string{}
+
+	for _, nodeId := range b.Deployment.Nodes {
+		node := b.Topology.Nodes[nodeId]
+
+		nodes = append(nodes, fmt.Sprintf(`Node({
+            "id": "%s",
+            "inputs": [%s],
+            "processor": %sProcessor,
+            "outputs": [%s]
+        })`, nodeId, strings.Join(buildConnectionInstanceNamesFromIds(node.Inputs), ", "), nodeId, strings.Join(buildConnectionInstanceNamesFromIds(node.Outputs), ", ")))
+	}
+
+	return fmt.Sprintf(`topology = Topology({
+    "id": "topology",
+    "nodes": [
+        %s
+    ]
+})`, strings.Join(nodes, ",\n        "))
+}
+
+// FillRequiredEnv checks, before anything is instantiated, that every
+// environment variable the connections and processors read is set, like
+// the node.js stage does.
+func (b *PythonPlatformBuilder) FillRequiredEnv() (requiredEnv string) {
+	entries := []string{}
+	for _, requirement := range collectEnvRequirements(b.Deployment, b.Topology, b.Environment) {
+		if requirement.HasDefault {
+			continue
+		}
+
+		usages := []string{}
+		for _, usage := range requirement.UsedBy {
+			usages = append(usages, jsonLiteral(usage.String()))
+		}
+		entries = append(entries, fmt.Sprintf(`    %s: [%s]`, jsonLiteral(requirement.Name), strings.Join(usages, ", ")))
+	}
+
+	return fmt.Sprintf(`required_env = {
+%s
+}
+
+missing_env = [name for name in required_env if name not in os.environ]
+if missing_env:
+    for name in missing_env:
+        print("missing environment variable " + name + " needed by " + ", ".join(required_env[name]), file=sys.stderr)
+    sys.exit(1)`, strings.Join(entries, ",\n"))
+}
+
+// FillStage renders stage.py, which serves /metrics on PORT and then runs
+// the topology until it stops.
+func (b *PythonPlatformBuilder) FillStage() (stage string) {
+	return fmt.Sprintf(`%s
+
+# CONFIGURATION ===========================================================
+
+%s
+
+# CONNECTIONS =============================================================
+
+%s
+
+# PROCESSORS ==============================================================
+
+%s
+
+# TOPOLOGY ================================================================
+
+%s
+
+# METRICS =================================================================
+
+start_http_server(int(os.environ["PORT"]))
+topology.log.info("listening on port: " + os.environ["PORT"])
+
+try:
+    topology.start()
+except Exception as err:
+    topology.log.error("topology start failed with: " + str(err))
+    sys.exit(1)
+`, b.FillImports(), b.FillRequiredEnv(), b.FillConnections(), b.FillProcessors(), b.FillTopology())
+}
+
+func (b *PythonPlatformBuilder) BuildSource() (err error) {
+	b.DeploymentPath = path.Join("build", b.Environment.Tier, b.DeploymentID)
+
+	err = ioutil.WriteFile(path.Join(b.DeploymentPath, "Dockerfile"), []byte(b.Image().Dockerfile), 0644)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(b.DeploymentPath, "start-stage"), []byte(pythonStartStage), 0755); err != nil {
+		return err
+	}
+
+	b.CodePath = b.DeploymentPath
+
+	b.ProcessorPath = path.Join(b.CodePath, "processors")
+	err = os.Mkdir(b.ProcessorPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(b.CodePath, "requirements.txt"), []byte(b.FillRequirementsTxt()), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(b.CodePath, "stage.py"), []byte(b.FillStage()), 0644)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyProcessors()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedStagePy = `import os
+import sys
+
+from prometheus_client import start_http_server
+from topological import Node, Topology
+
+from topological_kafka import Connection as arrivalScoresConnectionClass
+from topological_kafka import Connection as estimatedArrivalsConnectionClass
+from processors.fixtures.testdata.scoreArrivals import Processor as scoreArrivalsProcessorClass
+
+# CONFIGURATION ===========================================================
+
+required_env = {
+    "ARRIVAL_SCORES_TOPIC": ["connection arrivalScores: topic"],
+    "ESTIMATED_ARRIVALS_TOPIC": ["connection estimatedArrivals: topic"],
+    "KAFKA_ENDPOINT": ["connection arrivalScores: endpoint", "connection estimatedArrivals: endpoint"]
+}
+
+missing_env = [name for name in required_env if name not in os.environ]
+if missing_env:
+    for name in missing_env:
+        print("missing environment variable " + name + " needed by " + ", ".join(required_env[name]), file=sys.stderr)
+    sys.exit(1)
+
+# CONNECTIONS =============================================================
+
+arrivalScoresConnection = arrivalScoresConnectionClass({
+    "id": "arrivalScores",
+    "config": {"endpoint": os.environ["KAFKA_ENDPOINT"], "topic": os.environ["ARRIVAL_SCORES_TOPIC"]}
+})
+
+estimatedArrivalsConnection = estimatedArrivalsConnectionClass({
+    "id": "estimatedArrivals",
+    "config": {"endpoint": os.environ["KAFKA_ENDPOINT"], "topic": os.environ["ESTIMATED_ARRIVALS_TOPIC"]}
+})
+
+# PROCESSORS ==============================================================
+
+scoreArrivalsProcessor = scoreArrivalsProcessorClass({
+    "id": "scoreArrivals",
+    "config": {"explain": False, "model": os.environ.get("MODEL_PATH", "/models/arrivals.pkl"), "threshold": 0.8}
+})
+
+# TOPOLOGY ================================================================
+
+topology = Topology({
+    "id": "topology",
+    "nodes": [
+        Node({
+            "id": "scoreArrivals",
+            "inputs": [estimatedArrivalsConnection],
+            "processor": scoreArrivalsProcessor,
+            "outputs": [arrivalScoresConnection]
+        })
+    ]
+})
+
+# METRICS =================================================================
+
+start_http_server(int(os.environ["PORT"]))
+topology.log.info("listening on port: " + os.environ["PORT"])
+
+try:
+    topology.start()
+except Exception as err:
+    topology.log.error("topology start failed with: " + str(err))
+    sys.exit(1)
+`
+
+const expectedRequirementsTxt = `numpy>=1.26
+prometheus-client>=0.17
+scikit-learn==1.3.2
+topological-kafka>=1.0
+topological>=1.0
+`
+
+func TestFillRequirementsTxt(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/python-topology.json", "fixtures/python-environment.json", "score-arrivals", "")
+
+	requirementsTxt := platformBuilder.(*PythonPlatformBuilder).FillRequirementsTxt()
+	if requirementsTxt != expectedRequirementsTxt {
+		t.Errorf("requirements.txt did not match:-->%s<-- vs. -->%s<--", requirementsTxt, expectedRequirementsTxt)
+	}
+}
+
+func TestFillStagePy(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/python-topology.json", "fixtures/python-environment.json", "score-arrivals", "")
+
+	stagePy := platformBuilder.(*PythonPlatformBuilder).FillStage()
+	if stagePy != expectedStagePy {
+		t.Errorf("stage.py did not match:-->%s<-- vs. -->%s<--", stagePy, expectedStagePy)
+	}
+}
+
+func TestPythonPlatformBuilderValidate(t *testing.T) {
+	_, platformBuilder := loadPlatformBuilder(t, "fixtures/python-topology.json", "fixtures/python-environment.json", "score-arrivals", "")
+	builder := platformBuilder.(*PythonPlatformBuilder)
+
+	if diagnostics := builder.Validate(); len(diagnostics) != 0 {
+		t.Errorf("expected no problems with python fixtures, got: %v", diagnostics)
+	}
+
+	node := builder.Topology.Nodes["scoreArrivals"]
+	node.Processor.File = "./processors/score-arrivals.py"
+	builder.Topology.Nodes["scoreArrivals"] = node
+
+	diagnostics := builder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeInvalidProcessor) {
+		t.Errorf("expected one invalid-processor diagnostic, got: %v", diagnostics)
+	}
+
+	node.Processor.File = "./fixtures/testdata/scoreArrivals.py"
+	node.Processor.Dependencies = map[string]string{"numpy": "^1.0.0 || ^2.0.0"}
+	builder.Topology.Nodes["scoreArrivals"] = node
+
+	diagnostics = builder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeInvalidDependency) {
+		t.Errorf("expected one invalid-dependency diagnostic, got: %v", diagnostics)
+	}
+
+	node.Processor.Dependencies = nil
+	builder.Topology.Nodes["scoreArrivals"] = node
+
+	rescoreNode := node
+	rescoreNode.Processor.File = "./other/scoreArrivals.py"
+	builder.Topology.Nodes["rescoreArrivals"] = rescoreNode
+	builder.Deployment.Nodes = append(builder.Deployment.Nodes, "rescoreArrivals")
+
+	// processor files of one name are imported by their paths
+	if diagnostics := builder.Validate(); len(diagnostics) != 0 {
+		t.Errorf("expected no problems with processor files of one name, got: %v", diagnostics)
+	}
+
+	imports := builder.FillImports()
+	for _, expected := range []string{
+		"from processors.fixtures.testdata.scoreArrivals import Processor as scoreArrivalsProcessorClass",
+		"from processors.other.scoreArrivals import Processor as rescoreArrivalsProcessorClass",
+	} {
+		if !strings.Contains(imports, expected) {
+			t.Errorf("imports did not contain -->%s<--: %s", expected, imports)
+		}
+	}
+
+	node.Processor.Dependencies = map[string]string{"topological-kafka": "<1.0"}
+	builder.Topology.Nodes["scoreArrivals"] = node
+
+	diagnostics = builder.Validate()
+	if len(diagnostics) != 1 || !diagnostics.HasCode(CodeDependencyConflict) {
+		t.Errorf("expected one dependency-conflict diagnostic, got: %v", diagnostics)
+	}
+}
+
+func TestPythonRequirement(t *testing.T) {
+	requirements := map[string]string{
+		"":       "numpy",
+		"*":      "numpy",
+		"1.26.0": "numpy==1.26.0",
+		">=1.26": "numpy>=1.26",
+		"~=1.26": "numpy~=1.26",
+		"^1.0.4": "numpy>=1.0.4,<2.0.0",
+		"~1.2.3": "numpy>=1.2.3,<1.3.0",
+		"1.x":    "numpy>=1.0.0,<2.0.0",
+		"=1.2.3": "numpy==1.2.3",
+		">= 1.2": "numpy>= 1.2",
+	}
+
+	for version, expectedRequirement := range requirements {
+		if requirement, err := pythonRequirement("numpy", version); err != nil || requirement != expectedRequirement {
+			t.Errorf("requirement did not match:-->%s<-- vs. -->%s<--: %v", requirement, expectedRequirement, err)
+		}
+	}
+
+	for _, version := range []string{"^1.0.0 || ^2.0.0", "latest"} {
+		if _, err := pythonRequirement("numpy", version); err == nil {
+			t.Errorf("expected %s to be rejected", version)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 type ReplicaSpec struct {
-	Min int32
-	Max int32
+	Min          int32 `json:"min,omitempty"`
+	Max          int32 `json:"max,omitempty"`
+	LagThreshold int64 `json:"lagThreshold,omitempty"`
 }
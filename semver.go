@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a version as npm understands it. Build metadata is dropped as it
+// does not take part in comparisons.
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+func (v SemVer) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		version += "-" + v.Prerelease
+	}
+
+	return version
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePrerelease orders prerelease tags, a version without one coming
+// after every prerelease of it.
+func comparePrerelease(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for idx := 0; idx < len(aParts) && idx < len(bParts); idx++ {
+		aNumber, aErr := strconv.Atoi(aParts[idx])
+		bNumber, bErr := strconv.Atoi(bParts[idx])
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if comparison := compareInts(aNumber, bNumber); comparison != 0 {
+				return comparison
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case aParts[idx] != bParts[idx]:
+			if aParts[idx] < bParts[idx] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return compareInts(len(aParts), len(bParts))
+}
+
+func (v SemVer) Compare(other SemVer) int {
+	if comparison := compareInts(v.Major, other.Major); comparison != 0 {
+		return comparison
+	}
+	if comparison := compareInts(v.Minor, other.Minor); comparison != 0 {
+		return comparison
+	}
+	if comparison := compareInts(v.Patch, other.Patch); comparison != 0 {
+		return comparison
+	}
+
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// partialVersion is a version in a range, where trailing parts may be left
+// out or be wildcards, e.g. 1.2 or 1.x.
+type partialVersion struct {
+	Parts      []int
+	Prerelease string
+}
+
+var comparatorPattern = regexp.MustCompile(`^(<=|>=|<|>|=|~>|~|\^)?(.*)$`)
+
+// operatorSpacePattern finds a space between an operator and its version,
+// e.g. >= 1.2.0, which npm allows.
+var operatorSpacePattern = regexp.MustCompile(`(<=|>=|<|>|=|~>|~|\^)\s+`)
+
+var partialVersionPattern = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+func parsePartialVersion(text string) (version partialVersion, err error) {
+	match := partialVersionPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return version, errors.New(fmt.Sprintf("%q is not a version", text))
+	}
+
+	for _, part := range match[1:4] {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		version.Parts = append(version.Parts, number)
+	}
+
+	if len(version.Parts) == 3 {
+		version.Prerelease = match[4]
+	}
+
+	return version, nil
+}
+
+func (p partialVersion) part(idx int) int {
+	if idx < len(p.Parts) {
+		return p.Parts[idx]
+	}
+
+	return 0
+}
+
+// floor is the lowest version the partial version matches.
+func (p partialVersion) floor() SemVer {
+	return SemVer{Major: p.part(0), Minor: p.part(1), Patch: p.part(2), Prerelease: p.Prerelease}
+}
+
+// ceiling is the first version past those the partial version matches, e.g.
+// 1.3.0 for 1.2, or false when it matches every version.
+func (p partialVersion) ceiling() (SemVer, bool) {
+	switch len(p.Parts) {
+	case 0:
+		return SemVer{}, false
+	case 1:
+		return SemVer{Major: p.Parts[0] + 1}, true
+	case 2:
+		return SemVer{Major: p.Parts[0], Minor: p.Parts[1] + 1}, true
+	default:
+		return SemVer{Major: p.Parts[0], Minor: p.Parts[1], Patch: p.Parts[2] + 1}, true
+	}
+}
+
+// versionBound is one end of a versionInterval. A bound that is not Set
+// leaves that end open.
+type versionBound struct {
+	Set       bool
+	Version   SemVer
+	Inclusive bool
+}
+
+// versionInterval is the set of versions between two bounds.
+type versionInterval struct {
+	Lower versionBound
+	Upper versionBound
+}
+
+func (i versionInterval) empty() bool {
+	if !i.Lower.Set || !i.Upper.Set {
+		return false
+	}
+
+	comparison := i.Lower.Version.Compare(i.Upper.Version)
+	return comparison > 0 || (comparison == 0 && !(i.Lower.Inclusive && i.Upper.Inclusive))
+}
+
+func (i versionInterval) intersect(other versionInterval) versionInterval {
+	lower, upper := i.Lower, i.Upper
+
+	if other.Lower.Set {
+		comparison := 1
+		if lower.Set {
+			comparison = other.Lower.Version.Compare(lower.Version)
+		}
+		if comparison > 0 || (comparison == 0 && !other.Lower.Inclusive) {
+			lower = other.Lower
+		}
+	}
+
+	if other.Upper.Set {
+		comparison := -1
+		if upper.Set {
+			comparison = other.Upper.Version.Compare(upper.Version)
+		}
+		if comparison < 0 || (comparison == 0 && !other.Upper.Inclusive) {
+			upper = other.Upper
+		}
+	}
+
+	return versionInterval{Lower: lower, Upper: upper}
+}
+
+func (i versionInterval) String() string {
+	if i.Lower.Set && i.Upper.Set && i.Lower.Inclusive && i.Upper.Inclusive && i.Lower.Version.Compare(i.Upper.Version) == 0 {
+		return i.Lower.Version.String()
+	}
+
+	comparators := []string{}
+	if i.Lower.Set {
+		operator := ">"
+		if i.Lower.Inclusive {
+			operator = ">="
+		}
+		comparators = append(comparators, operator+i.Lower.Version.String())
+	}
+	if i.Upper.Set {
+		operator := "<"
+		if i.Upper.Inclusive {
+			operator = "<="
+		}
+		comparators = append(comparators, operator+i.Upper.Version.String())
+	}
+
+	if len(comparators) == 0 {
+		return "*"
+	}
+
+	return strings.Join(comparators, " ")
+}
+
+func atLeast(version SemVer) versionBound {
+	return versionBound{Set: true, Version: version, Inclusive: true}
+}
+
+func below(version SemVer) versionBound {
+	return versionBound{Set: true, Version: version}
+}
+
+// comparatorInterval converts one comparator such as ^1.2.0 or <=2 into the
+// versions it allows.
+func comparatorInterval(comparator string) (interval versionInterval, err error) {
+	match := comparatorPattern.FindStringSubmatch(comparator)
+	operator := match[1]
+
+	version, err := parsePartialVersion(match[2])
+	if err != nil {
+		return interval, err
+	}
+
+	floor := version.floor()
+	ceiling, bounded := version.ceiling()
+
+	switch operator {
+	case "", "=":
+		interval.Lower = atLeast(floor)
+		if len(version.Parts) == 3 {
+			interval.Upper = versionBound{Set: true, Version: floor, Inclusive: true}
+		} else if bounded {
+			interval.Upper = below(ceiling)
+		} else {
+			interval.Lower = versionBound{}
+		}
+	case ">":
+		if len(version.Parts) == 3 {
+			interval.Lower = versionBound{Set: true, Version: floor}
+		} else if bounded {
+			interval.Lower = atLeast(ceiling)
+		} else {
+			// >* matches nothing
+			interval.Lower, interval.Upper = atLeast(SemVer{Major: 1}), below(SemVer{})
+		}
+	case ">=":
+		if len(version.Parts) > 0 {
+			interval.Lower = atLeast(floor)
+		}
+	case "<":
+		if len(version.Parts) > 0 {
+			interval.Upper = below(floor)
+		} else {
+			interval.Lower, interval.Upper = atLeast(SemVer{Major: 1}), below(SemVer{})
+		}
+	case "<=":
+		if len(version.Parts) == 3 {
+			interval.Upper = versionBound{Set: true, Version: floor, Inclusive: true}
+		} else if bounded {
+			interval.Upper = below(ceiling)
+		}
+	case "~", "~>":
+		interval.Lower = atLeast(floor)
+		if len(version.Parts) == 1 {
+			interval.Upper = below(SemVer{Major: floor.Major + 1})
+		} else if len(version.Parts) > 1 {
+			interval.Upper = below(SemVer{Major: floor.Major, Minor: floor.Minor + 1})
+		} else {
+			interval.Lower = versionBound{}
+		}
+	case "^":
+		interval.Lower = atLeast(floor)
+		switch {
+		case len(version.Parts) == 0:
+			interval.Lower = versionBound{}
+		case floor.Major > 0 || len(version.Parts) == 1:
+			interval.Upper = below(SemVer{Major: floor.Major + 1})
+		case floor.Minor > 0 || len(version.Parts) == 2:
+			interval.Upper = below(SemVer{Minor: floor.Minor + 1})
+		default:
+			interval.Upper = below(SemVer{Patch: floor.Patch + 1})
+		}
+	}
+
+	return interval, nil
+}
+
+// SemVerRange is a union of version intervals, as npm's || joins them.
+type SemVerRange []versionInterval
+
+var hyphenRangePattern = regexp.MustCompile(`^(\S+)\s+-\s+(\S+)$`)
+
+// ParseSemVerRange parses an npm version range, such as ^1.2.0, ~1.2,
+// >=1.0.0 <2.0.0, 1.2.x, 1.0.0 - 1.4.0 or ^1.0.0 || ^2.0.0.
+func ParseSemVerRange(text string) (semVerRange SemVerRange, err error) {
+	for _, set := range strings.Split(text, "||") {
+		set = strings.TrimSpace(set)
+		interval := versionInterval{}
+
+		if match := hyphenRangePattern.FindStringSubmatch(set); match != nil {
+			from, err := parsePartialVersion(match[1])
+			if err != nil {
+				return nil, err
+			}
+			to, err := parsePartialVersion(match[2])
+			if err != nil {
+				return nil, err
+			}
+
+			if len(from.Parts) > 0 {
+				interval.Lower = atLeast(from.floor())
+			}
+			if len(to.Parts) == 3 {
+				interval.Upper = versionBound{Set: true, Version: to.floor(), Inclusive: true}
+			} else if ceiling, bounded := to.ceiling(); bounded {
+				interval.Upper = below(ceiling)
+			}
+		} else if set != "" {
+			set = operatorSpacePattern.ReplaceAllString(set, "$1")
+			for _, comparator := range strings.Fields(set) {
+				comparatorRange, err := comparatorInterval(comparator)
+				if err != nil {
+					return nil, err
+				}
+				interval = interval.intersect(comparatorRange)
+			}
+		}
+
+		if !interval.empty() {
+			semVerRange = append(semVerRange, interval)
+		}
+	}
+
+	if len(semVerRange) == 0 {
+		return nil, errors.New(fmt.Sprintf("%q matches no version", text))
+	}
+
+	return semVerRange, nil
+}
+
+// Intersect returns the versions both ranges allow, which is empty when
+// they conflict.
+func (r SemVerRange) Intersect(other SemVerRange) (intersection SemVerRange) {
+	seen := map[string]bool{}
+	for _, interval := range r {
+		for _, otherInterval := range other {
+			intersected := interval.intersect(otherInterval)
+			if !intersected.empty() && !seen[intersected.String()] {
+				seen[intersected.String()] = true
+				intersection = append(intersection, intersected)
+			}
+		}
+	}
+
+	return intersection
+}
+
+// String renders the range with comparators only, e.g. >=1.2.0 <2.0.0 for
+// ^1.2.0, so that equal ranges render the same.
+func (r SemVerRange) String() string {
+	sets := []string{}
+	for _, interval := range r {
+		sets = append(sets, interval.String())
+	}
+
+	return strings.Join(sets, " || ")
+}
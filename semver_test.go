@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSemVerRange(t *testing.T) {
+	ranges := map[string]string{
+		"^1.2.3":          ">=1.2.3 <2.0.0",
+		"^0.2.3":          ">=0.2.3 <0.3.0",
+		"^0.0.3":          ">=0.0.3 <0.0.4",
+		"^1.2":            ">=1.2.0 <2.0.0",
+		"~1.2.3":          ">=1.2.3 <1.3.0",
+		"~1":              ">=1.0.0 <2.0.0",
+		"1.2.x":           ">=1.2.0 <1.3.0",
+		"1.2.3":           "1.2.3",
+		"=v1.2.3":         "1.2.3",
+		"*":               "*",
+		"":                "*",
+		">= 1.0.0 < 1.4":  ">=1.0.0 <1.4.0",
+		">1.2":            ">=1.3.0",
+		"<=1.2":           "<1.3.0",
+		"1.0.0 - 1.4":     ">=1.0.0 <1.5.0",
+		"1.0.0 - 1.4.2":   ">=1.0.0 <=1.4.2",
+		"^1.0.0 || ^2.1":  ">=1.0.0 <2.0.0 || >=2.1.0 <3.0.0",
+		"1.2.3-beta.2":    "1.2.3-beta.2",
+		"^2.0.0-alpha.1 ": ">=2.0.0-alpha.1 <3.0.0",
+	}
+
+	for text, expectedRange := range ranges {
+		semVerRange, err := ParseSemVerRange(text)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", text, err)
+			continue
+		}
+		if semVerRange.String() != expectedRange {
+			t.Errorf("range %q did not match:-->%s<-- vs. -->%s<--", text, semVerRange.String(), expectedRange)
+		}
+	}
+
+	for _, text := range []string{"latest", "github:timfpark/topological", "file:../lib", ">2.0.0 <1.0.0"} {
+		if _, err := ParseSemVerRange(text); err == nil {
+			t.Errorf("expected %q to fail to parse", text)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	versions := []SemVer{
+		{Major: 1, Minor: 0, Patch: 0, Prerelease: "alpha"},
+		{Major: 1, Minor: 0, Patch: 0, Prerelease: "alpha.1"},
+		{Major: 1, Minor: 0, Patch: 0, Prerelease: "alpha.beta"},
+		{Major: 1, Minor: 0, Patch: 0, Prerelease: "beta.2"},
+		{Major: 1, Minor: 0, Patch: 0, Prerelease: "beta.11"},
+		{Major: 1, Minor: 0, Patch: 0},
+		{Major: 1, Minor: 0, Patch: 1},
+		{Major: 1, Minor: 10, Patch: 0},
+	}
+
+	for idx := 1; idx < len(versions); idx++ {
+		if versions[idx-1].Compare(versions[idx]) >= 0 || versions[idx].Compare(versions[idx-1]) <= 0 {
+			t.Errorf("expected %s to come before %s", versions[idx-1], versions[idx])
+		}
+	}
+}
+
+func TestSemVerRangeIntersect(t *testing.T) {
+	intersections := []struct {
+		a, b     string
+		expected string
+	}{
+		{"^3.3.0", "^3.5.1", ">=3.5.1 <4.0.0"},
+		{"^3.3.0", "~3.4.1", ">=3.4.1 <3.5.0"},
+		{"^3.3.0", "^4.0.0", ""},
+		{">=1.0.0", "<=1.0.0", "1.0.0"},
+		{">1.0.0", "<=1.0.0", ""},
+		{"^1.0.0 || ^2.0.0", "^2.1.0 || ^3.0.0", ">=2.1.0 <3.0.0"},
+		{"*", "1.x", ">=1.0.0 <2.0.0"},
+	}
+
+	for _, intersection := range intersections {
+		a, _ := ParseSemVerRange(intersection.a)
+		b, _ := ParseSemVerRange(intersection.b)
+		if actual := a.Intersect(b).String(); actual != intersection.expected {
+			t.Errorf("intersection of %s and %s did not match:-->%s<-- vs. -->%s<--", intersection.a, intersection.b, actual, intersection.expected)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// SourceMap records where each value of a definition starts so that
+// diagnostics can point at file:line:column. Paths use the dotted form
+// deployments.predict-arrivals.nodes[0]. Once overlays are merged, positions
+// may point into any of the files that make up the definition.
+type SourceMap struct {
+	File      string
+	positions map[string]Position
+	overrides map[string][]Provenance
+}
+
+func NewSourceMap(file string) *SourceMap {
+	return &SourceMap{
+		File:      file,
+		positions: map[string]Position{},
+		overrides: map[string][]Provenance{},
+	}
+}
+
+func joinPath(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s.%s", parent, key)
+}
+
+func indexPath(parent string, index int) string {
+	return fmt.Sprintf("%s[%d]", parent, index)
+}
+
+// parentPath strips the last key or index from a path.
+func parentPath(path string) string {
+	lastDot := strings.LastIndex(path, ".")
+	lastBracket := strings.LastIndex(path, "[")
+	if lastBracket > lastDot {
+		return path[:lastBracket]
+	}
+	if lastDot >= 0 {
+		return path[:lastDot]
+	}
+
+	return ""
+}
+
+// Locate returns the position of path, falling back to the nearest enclosing
+// value when the path itself was not present in the file.
+func (s *SourceMap) Locate(path string) (line int, column int) {
+	position := s.LocatePosition(path)
+	return position.Line, position.Column
+}
+
+// LocatePosition is Locate, but also returns the file the value came from.
+func (s *SourceMap) LocatePosition(path string) Position {
+	if s == nil {
+		return Position{}
+	}
+
+	for {
+		if position, ok := s.positions[path]; ok {
+			return position
+		}
+		if path == "" {
+			return Position{File: s.File}
+		}
+		path = parentPath(path)
+	}
+}
+
+// Lookup returns the position recorded for exactly path.
+func (s *SourceMap) Lookup(path string) (position Position, ok bool) {
+	if s == nil {
+		return Position{}, false
+	}
+
+	position, ok = s.positions[path]
+	return position, ok
+}
+
+func (s *SourceMap) Set(path string, position Position) {
+	if position.File == "" {
+		position.File = s.File
+	}
+
+	s.positions[path] = position
+}
+
+func (s *SourceMap) setIfAbsent(path string, position Position) {
+	if _, ok := s.positions[path]; !ok {
+		s.Set(path, position)
+	}
+}
+
+// Remove forgets path and everything nested beneath it.
+func (s *SourceMap) Remove(path string) {
+	for candidate := range s.positions {
+		if candidate == path || strings.HasPrefix(candidate, path+".") || strings.HasPrefix(candidate, path+"[") {
+			delete(s.positions, candidate)
+		}
+	}
+}
+
+func offsetPosition(contents []byte, offset int) Position {
+	if offset > len(contents) {
+		offset = len(contents)
+	}
+
+	line := bytes.Count(contents[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(contents[:offset], '\n')
+
+	return Position{Line: line, Column: column}
+}
+
+func skipJSONSeparators(contents []byte, offset int) int {
+	for offset < len(contents) {
+		switch contents[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+
+	return offset
+}
+
+// IndexJSON walks contents and records the position of every object member
+// and array element.
+func (s *SourceMap) IndexJSON(contents []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	return s.indexJSONValue(decoder, contents, "")
+}
+
+func (s *SourceMap) indexJSONValue(decoder *json.Decoder, contents []byte, path string) error {
+	start := skipJSONSeparators(contents, int(decoder.InputOffset()))
+	s.setIfAbsent(path, offsetPosition(contents, start))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for decoder.More() {
+			keyStart := skipJSONSeparators(contents, int(decoder.InputOffset()))
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+
+			memberPath := joinPath(path, keyToken.(string))
+			s.Set(memberPath, offsetPosition(contents, keyStart))
+
+			err = s.indexJSONValue(decoder, contents, memberPath)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = decoder.Token()
+	case json.Delim('['):
+		for index := 0; decoder.More(); index++ {
+			err = s.indexJSONValue(decoder, contents, indexPath(path, index))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = decoder.Token()
+	}
+
+	return err
+}
+
+// decodeDiagnostic turns an encoding/json error into a diagnostic positioned
+// at the offending byte offset.
+func decodeDiagnostic(source *SourceMap, contents []byte, err error) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeParseError,
+		File:     source.File,
+		Message:  err.Error(),
+	}
+
+	var offset int64 = -1
+	switch typedErr := err.(type) {
+	case *json.SyntaxError:
+		offset = typedErr.Offset
+	case *json.UnmarshalTypeError:
+		offset = typedErr.Offset
+		diagnostic.Path = typedErr.Field
+		diagnostic.Message = fmt.Sprintf("expected %s but found %s", typedErr.Type, typedErr.Value)
+	}
+
+	if offset >= 0 {
+		position := offsetPosition(contents, int(offset))
+		diagnostic.Line, diagnostic.Column = position.Line, position.Column
+	}
+
+	return diagnostic
+}
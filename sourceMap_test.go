@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+const sourceMapJSON = `{
+    "deployments": {
+        "predict-arrivals": {
+            "nodes": ["predictArrivals", "notifyArrivals"]
+        }
+    }
+}`
+
+func TestSourceMapLocate(t *testing.T) {
+	source := NewSourceMap("environment.json")
+	err := source.IndexJSON([]byte(sourceMapJSON))
+	if err != nil {
+		t.Errorf("IndexJSON failed: %s", err)
+	}
+
+	line, column := source.Locate("deployments.predict-arrivals.nodes[1]")
+	if line != 4 || column != 42 {
+		t.Errorf("nodes[1] located at %d:%d", line, column)
+	}
+
+	line, column = source.Locate("deployments.predict-arrivals")
+	if line != 3 || column != 9 {
+		t.Errorf("predict-arrivals located at %d:%d", line, column)
+	}
+
+	// paths that are not in the file fall back to their nearest parent
+	line, column = source.Locate("deployments.predict-arrivals.replicas.min")
+	if line != 3 || column != 9 {
+		t.Errorf("missing path located at %d:%d", line, column)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// systemdBasePort is the port of the first instance of the first systemd
+// deployment. Instances are named after the port they listen on, and each
+// deployment's ports follow those of the instances before it.
+const systemdBasePort = 8080
+
+const systemdUnitTemplate = `[Unit]
+Description=%[1]s stage of the %[2]s topology on port %%i
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+DynamicUser=yes
+WorkingDirectory=%[3]s
+ExecStart=/usr/bin/env %[7]s
+Environment=PORT=%%i
+%[4]s
+EnvironmentFile=%[5]s
+Restart=on-failure
+%[6]s
+[Install]
+WantedBy=multi-user.target
+`
+
+const installStageTemplate = `#!/bin/bash
+
+# installs the %[1]s stage on this host as %[2]s, run as root
+
+set -e
+
+cd "$(dirname "$0")"
+
+INSTALL_DIR=%[3]s
+ENV_FILE=%[4]s
+
+mkdir -p $INSTALL_DIR $(dirname $ENV_FILE)
+tar --exclude=./systemd --exclude=./install-stage -cf - . | tar -xf - -C $INSTALL_DIR
+(cd $INSTALL_DIR && %[5]s)
+
+if [ ! -f $ENV_FILE ]; then
+    cp systemd/%[1]s.env.example $ENV_FILE
+    echo "fill in $ENV_FILE before starting %[1]s"
+fi
+
+cp systemd/%[1]s@.service /etc/systemd/system/
+systemctl daemon-reload
+systemctl enable %[2]s
+systemctl restart %[2]s
+`
+
+// systemdCPUQuota converts a Kubernetes CPU quantity such as 250m into a
+// systemd CPUQuota such as 25%.
+func systemdCPUQuota(quantity string) string {
+	cpus := composeCPUs(quantity)
+	value, err := strconv.ParseFloat(cpus, 64)
+	if err != nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(value*100, 'f', -1, 64) + "%"
+}
+
+// systemdMemory converts a Kubernetes memory quantity such as 512Mi into a
+// systemd size such as 512M. systemd reads K, M and G as powers of 1024, so
+// a decimal quantity such as 1G is converted to bytes.
+func systemdMemory(quantity string) string {
+	if quantity == "" || strings.HasSuffix(quantity, "i") {
+		return strings.TrimSuffix(quantity, "i")
+	}
+
+	return memoryBytes(quantity)
+}
+
+func (b *Builder) systemdInstallPath(deploymentID string) string {
+	return path.Join("/opt", b.Topology.Name, deploymentID)
+}
+
+func (b *Builder) systemdEnvFile(deploymentID string) string {
+	return path.Join("/etc", b.Topology.Name, deploymentID+".env")
+}
+
+// systemdInstanceCount is the number of instances of a deployment, one per
+// Replicas.Min and at least one.
+func (b *Builder) systemdInstanceCount(deploymentID string) int {
+	count := int(b.Environment.Deployments[deploymentID].Replicas.Min)
+	if count < 1 {
+		count = 1
+	}
+
+	return count
+}
+
+// SystemdInstances names the instances of a deployment's templated unit
+// after their ports, which start past those of the systemd deployments
+// sorted before it.
+func (b *Builder) SystemdInstances(deploymentID string) (instances []string) {
+	firstPort := systemdBasePort
+	for _, systemdDeploymentID := range b.Environment.DeploymentsWithTarget(TargetSystemd) {
+		if systemdDeploymentID == deploymentID {
+			break
+		}
+		firstPort += b.systemdInstanceCount(systemdDeploymentID)
+	}
+
+	count := b.systemdInstanceCount(deploymentID)
+	for instance := 0; instance < count; instance++ {
+		instances = append(instances, fmt.Sprintf("%s@%d.service", deploymentID, firstPort+instance))
+	}
+
+	return instances
+}
+
+// FillSystemdUnit renders the templated unit of a deployment. Config env
+// vars are read from its EnvironmentFile, which install-stage seeds from the
+// .env.example next to the unit.
+func (b *Builder) FillSystemdUnit(deploymentID string, image PlatformImage) string {
+	deployment := b.Environment.Deployments[deploymentID]
+
+	environment := []string{}
+	if deployment.LogSeverity != "" {
+		environment = append(environment, fmt.Sprintf("Environment=LOG_SEVERITY=%s", deployment.LogSeverity))
+	}
+
+	limits := ""
+	if memory := systemdMemory(deployment.Memory.Limit); deployment.Memory.Limit != "" && memory != "" {
+		limits += fmt.Sprintf("MemoryMax=%s\n", memory)
+	}
+	if quota := systemdCPUQuota(deployment.CPU.Limit); deployment.CPU.Limit != "" && quota != "" {
+		limits += fmt.Sprintf("CPUQuota=%s\n", quota)
+	}
+
+	return fmt.Sprintf(systemdUnitTemplate,
+		deploymentID,
+		b.Topology.Name,
+		b.systemdInstallPath(deploymentID),
+		strings.Join(environment, "\n"),
+		b.systemdEnvFile(deploymentID),
+		limits,
+		strings.Join(image.Command, " "))
+}
+
+// BuildSystemd writes the unit and .env.example of a deployment to its
+// systemd directory, and an install-stage script that installs the generated
+// stage under /opt/<topology>/<deployment> and starts its instances, using
+// the install, build and run commands of the deployment's platform.
+func (b *Builder) BuildSystemd(deploymentID string, image PlatformImage) (err error) {
+	if len(image.Command) == 0 {
+		return errors.New(fmt.Sprintf("the platform of deployment %s gave no command to run its stage with systemd", deploymentID))
+	}
+
+	systemdPath := path.Join(b.DeploymentPath, "systemd")
+	if err = os.MkdirAll(systemdPath, 0755); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(systemdPath, deploymentID+"@.service"), []byte(b.FillSystemdUnit(deploymentID, image)), 0644); err != nil {
+		return err
+	}
+
+	requirements := collectEnvRequirements(b.Environment.Deployments[deploymentID], b.Topology, b.Environment)
+	if err = ioutil.WriteFile(path.Join(systemdPath, deploymentID+".env.example"), []byte(FillEnvExample(deploymentID, requirements)), 0644); err != nil {
+		return err
+	}
+
+	install := strings.Join(image.Install, " ")
+	if len(image.Build) > 0 {
+		install += " && " + strings.Join(image.Build, " ")
+	}
+
+	installStage := fmt.Sprintf(installStageTemplate,
+		deploymentID,
+		strings.Join(b.SystemdInstances(deploymentID), " "),
+		b.systemdInstallPath(deploymentID),
+		b.systemdEnvFile(deploymentID),
+		install)
+
+	return ioutil.WriteFile(path.Join(b.DeploymentPath, "install-stage"), []byte(installStage), 0755)
+}
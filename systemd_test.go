@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const expectedWriteLocationsUnit = `[Unit]
+Description=write-locations stage of the location-pipeline topology on port %i
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+DynamicUser=yes
+WorkingDirectory=/opt/location-pipeline/write-locations
+ExecStart=/usr/bin/env node stage.js
+Environment=PORT=%i
+Environment=LOG_SEVERITY=info
+EnvironmentFile=/etc/location-pipeline/write-locations.env
+Restart=on-failure
+MemoryMax=512M
+CPUQuota=100%
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func TestFillSystemdUnit(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/edge.yaml")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	unit := builder.FillSystemdUnit("write-locations", (&NodeJsPlatformBuilder{}).Image())
+	if unit != expectedWriteLocationsUnit {
+		t.Errorf("unit did not match:-->%s<-- vs. -->%s<--", unit, expectedWriteLocationsUnit)
+	}
+
+	instances := strings.Join(builder.SystemdInstances("write-locations"), " ")
+	if instances != "write-locations@8082.service write-locations@8083.service" {
+		t.Errorf("instances did not match: %s", instances)
+	}
+
+	instances = strings.Join(builder.SystemdInstances("notify-arrivals"), " ")
+	if instances != "notify-arrivals@8080.service" {
+		t.Errorf("instances did not match: %s", instances)
+	}
+}
+
+func TestSystemdResources(t *testing.T) {
+	quantities := [][]string{
+		{systemdCPUQuota("250m"), "25%"},
+		{systemdCPUQuota("2"), "200%"},
+		{systemdMemory("512Mi"), "512M"},
+		{systemdMemory("1G"), "1000000000"},
+		{systemdMemory("1.5Gi"), "1.5G"},
+		{systemdMemory("128974848"), "128974848"},
+		{systemdMemory("500k"), "500000"},
+	}
+
+	for _, quantity := range quantities {
+		if quantity[0] != quantity[1] {
+			t.Errorf("quantity did not match:-->%s<-- vs. -->%s<--", quantity[0], quantity[1])
+		}
+	}
+}
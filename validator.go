@@ -0,0 +1,340 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+type Validator struct {
+	Topology    Topology
+	Environment Environment
+
+	TopologySource    *SourceMap
+	EnvironmentSource *SourceMap
+}
+
+func NewValidator(topology Topology, environment Environment) *Validator {
+	return &Validator{
+		Topology:    topology,
+		Environment: environment,
+	}
+}
+
+func sortedNodeIds(nodes map[string]Node) []string {
+	nodeIds := make([]string, 0, len(nodes))
+	for nodeId := range nodes {
+		nodeIds = append(nodeIds, nodeId)
+	}
+	sort.Strings(nodeIds)
+
+	return nodeIds
+}
+
+func sortedDeploymentIds(deployments map[string]Deployment) []string {
+	deploymentIds := make([]string, 0, len(deployments))
+	for deploymentId := range deployments {
+		deploymentIds = append(deploymentIds, deploymentId)
+	}
+	sort.Strings(deploymentIds)
+
+	return deploymentIds
+}
+
+func (v *Validator) checkConnections() (diagnostics Diagnostics) {
+	for _, nodeId := range sortedNodeIds(v.Topology.Nodes) {
+		node := v.Topology.Nodes[nodeId]
+		nodePath := joinPath("nodes", nodeId)
+
+		for idx, connectionId := range node.Inputs {
+			if _, ok := v.Environment.Connections[connectionId]; !ok {
+				diagnostics.Errorf(CodeUnknownConnection, v.TopologySource, indexPath(joinPath(nodePath, "inputs"), idx), "unknown connection %q", connectionId)
+			}
+		}
+		for idx, connectionId := range node.Outputs {
+			if _, ok := v.Environment.Connections[connectionId]; !ok {
+				diagnostics.Errorf(CodeUnknownConnection, v.TopologySource, indexPath(joinPath(nodePath, "outputs"), idx), "unknown connection %q", connectionId)
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkDeployments() (diagnostics Diagnostics) {
+	nodeDeployments := map[string]string{}
+
+	for _, deploymentID := range sortedDeploymentIds(v.Environment.Deployments) {
+		deployment := v.Environment.Deployments[deploymentID]
+		nodesPath := joinPath(joinPath("deployments", deploymentID), "nodes")
+
+		var platform string
+		for idx, nodeId := range deployment.Nodes {
+			nodePath := indexPath(nodesPath, idx)
+
+			node, nodeExists := v.Topology.Nodes[nodeId]
+			if !nodeExists {
+				diagnostics.Errorf(CodeUnknownNode, v.EnvironmentSource, nodePath, "unknown node %q", nodeId)
+				continue
+			}
+
+			if otherDeploymentID, ok := nodeDeployments[nodeId]; ok {
+				diagnostics.Errorf(CodeDuplicateNode, v.EnvironmentSource, nodePath, "node %q is already part of deployment %q", nodeId, otherDeploymentID)
+			} else {
+				nodeDeployments[nodeId] = deploymentID
+			}
+
+			if platform != "" && node.Processor.Platform != platform {
+				diagnostics.Errorf(CodeMismatchedPlatform, v.EnvironmentSource, nodePath, "mismatched platforms: %s vs %s for deployment id %s", platform, node.Processor.Platform, deploymentID)
+			} else {
+				platform = node.Processor.Platform
+			}
+		}
+	}
+
+	for _, nodeId := range sortedNodeIds(v.Topology.Nodes) {
+		if _, ok := nodeDeployments[nodeId]; !ok {
+			diagnostics.Errorf(CodeUndeployedNode, v.TopologySource, joinPath("nodes", nodeId), "node %q is not part of any deployment", nodeId)
+		}
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkProcessorEnvs() (diagnostics Diagnostics) {
+	processorIds := make([]string, 0, len(v.Environment.Processors))
+	for processorId := range v.Environment.Processors {
+		processorIds = append(processorIds, processorId)
+	}
+	sort.Strings(processorIds)
+
+	for _, processorId := range processorIds {
+		if _, ok := v.Topology.Nodes[processorId]; !ok {
+			diagnostics.Errorf(CodeUnknownProcessor, v.EnvironmentSource, joinPath("processors", processorId), "processor config for unknown node %q", processorId)
+		}
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkConfig(config map[string]interface{}, configPath string) (diagnostics Diagnostics) {
+	_, err := ParseConfig(config)
+	if configErr, ok := err.(*ConfigError); ok {
+		diagnostics.Errorf(CodeInvalidConfig, v.EnvironmentSource, joinPath(configPath, configErr.Path), "%s", configErr.Message)
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkConfigs() (diagnostics Diagnostics) {
+	connectionIds := make([]string, 0, len(v.Environment.Connections))
+	for connectionId := range v.Environment.Connections {
+		connectionIds = append(connectionIds, connectionId)
+	}
+	sort.Strings(connectionIds)
+
+	for _, connectionId := range connectionIds {
+		configPath := joinPath(joinPath("connections", connectionId), "config")
+		diagnostics = append(diagnostics, v.checkConfig(v.Environment.Connections[connectionId].Config, configPath)...)
+	}
+
+	processorIds := make([]string, 0, len(v.Environment.Processors))
+	for processorId := range v.Environment.Processors {
+		processorIds = append(processorIds, processorId)
+	}
+	sort.Strings(processorIds)
+
+	for _, processorId := range processorIds {
+		configPath := joinPath(joinPath("processors", processorId), "config")
+		diagnostics = append(diagnostics, v.checkConfig(v.Environment.Processors[processorId].Config, configPath)...)
+	}
+
+	return diagnostics
+}
+
+// checkEnvDefaults warns about environment variables that config values
+// read with different defaults, as the stage can only be given one value.
+func (v *Validator) checkEnvDefaults() (diagnostics Diagnostics) {
+	reported := map[string]bool{}
+	for _, deploymentID := range sortedDeploymentIds(v.Environment.Deployments) {
+		for _, requirement := range collectEnvRequirements(v.Environment.Deployments[deploymentID], v.Topology, v.Environment) {
+			for _, conflict := range requirement.conflicts {
+				configPath := conflict.Usage.ConfigPath()
+				if reported[configPath] {
+					continue
+				}
+				reported[configPath] = true
+
+				diagnostics.Warnf(CodeConflictingDefaults, v.EnvironmentSource, configPath, "%s defaults to %s here, but to %s for %s", requirement.Name, jsonLiteral(conflict.Default), jsonLiteral(conflict.EarlierDefault), conflict.DefaultedBy)
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkProcessorFiles() (diagnostics Diagnostics) {
+	for _, nodeId := range sortedNodeIds(v.Topology.Nodes) {
+		node := v.Topology.Nodes[nodeId]
+		filePath := joinPath(joinPath(joinPath("nodes", nodeId), "processor"), "file")
+
+		if node.Processor.File == "" {
+			diagnostics.Errorf(CodeMissingProcessor, v.TopologySource, filePath, "node %q does not specify a processor file", nodeId)
+			continue
+		}
+
+		// go processors may be packages of other modules, fetched by the build
+		if node.Processor.Platform == goPlatform && !isLocalGoPackage(node.Processor.File) {
+			continue
+		}
+
+		if _, err := os.Stat(node.Processor.File); err != nil {
+			diagnostics.Errorf(CodeMissingProcessor, v.TopologySource, filePath, "processor file %s is not readable: %s", node.Processor.File, err)
+		}
+	}
+
+	return diagnostics
+}
+
+// connectionPath returns the path of the first place nodeId lists connectionId
+// among its inputs or outputs.
+func connectionPath(nodeId string, connections []string, field string, connectionId string) string {
+	for idx, candidateId := range connections {
+		if candidateId == connectionId {
+			return indexPath(joinPath(joinPath("nodes", nodeId), field), idx)
+		}
+	}
+
+	return joinPath("nodes", nodeId)
+}
+
+func (v *Validator) checkGraph() (diagnostics Diagnostics) {
+	graph := NewGraph(v.Topology)
+
+	for _, cycle := range graph.Cycles() {
+		allowed := false
+		for _, nodeId := range cycle {
+			if v.Topology.Nodes[nodeId].AllowCycle {
+				allowed = true
+			}
+		}
+
+		cyclePath := joinPath("nodes", cycle[0])
+		if allowed {
+			diagnostics.Warnf(CodeCycle, v.TopologySource, cyclePath, "nodes %s form an allowed cycle", strings.Join(cycle, ", "))
+		} else {
+			diagnostics.Errorf(CodeCycle, v.TopologySource, cyclePath, "nodes %s form a cycle; set allowCycle on one of them if the feedback is intentional", strings.Join(cycle, ", "))
+		}
+	}
+
+	for _, connectionId := range graph.UnreadConnections() {
+		writerId := graph.Writers[connectionId][0]
+		path := connectionPath(writerId, v.Topology.Nodes[writerId].Outputs, "outputs", connectionId)
+		diagnostics.Warnf(CodeUnreadConnection, v.TopologySource, path, "connection %q is written but never read", connectionId)
+	}
+
+	for _, connectionId := range graph.UnwrittenConnections() {
+		readerId := graph.Readers[connectionId][0]
+		path := connectionPath(readerId, v.Topology.Nodes[readerId].Inputs, "inputs", connectionId)
+		diagnostics.Infof(CodeUnwrittenConnection, v.TopologySource, path, "connection %q is read but never written, so it must be fed from outside the topology", connectionId)
+	}
+
+	for _, nodeId := range graph.Unreachable() {
+		diagnostics.Warnf(CodeUnreachableNode, v.TopologySource, joinPath("nodes", nodeId), "node %q is not reachable from any source", nodeId)
+	}
+
+	return diagnostics
+}
+
+// isKnownTarget is true for the targets topo can build.
+func isKnownTarget(target string) bool {
+	for _, knownTarget := range knownTargets {
+		if target == knownTarget {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Validator) checkTarget() (diagnostics Diagnostics) {
+	// environments without a target predate targets and build Helm charts
+	if v.Environment.Target != "" && !isKnownTarget(v.Environment.Target) {
+		diagnostics.Errorf(CodeUnknownTarget, v.EnvironmentSource, "target", "unknown target %q, expected one of %s", v.Environment.Target, strings.Join(knownTargets, ", "))
+	}
+
+	for _, deploymentId := range sortedDeploymentIds(v.Environment.Deployments) {
+		target := v.Environment.Deployments[deploymentId].Target
+		if target != "" && !isKnownTarget(target) {
+			diagnostics.Errorf(CodeUnknownTarget, v.EnvironmentSource, joinPath(joinPath("deployments", deploymentId), "target"), "unknown target %q, expected one of %s", target, strings.Join(knownTargets, ", "))
+		}
+	}
+
+	return diagnostics
+}
+
+func (v *Validator) checkReplicas() (diagnostics Diagnostics) {
+	for _, deploymentId := range sortedDeploymentIds(v.Environment.Deployments) {
+		deployment := v.Environment.Deployments[deploymentId]
+		replicas := deployment.Replicas
+		replicasPath := joinPath(joinPath("deployments", deploymentId), "replicas")
+
+		if replicas.Max == 0 {
+			continue
+		}
+
+		if replicas.Max < replicas.Min {
+			diagnostics.Errorf(CodeInvalidReplicas, v.EnvironmentSource, joinPath(replicasPath, "max"), "replicas.max %d is less than replicas.min %d", replicas.Max, replicas.Min)
+			continue
+		}
+
+		inputs := map[string]bool{}
+		for _, nodeId := range deployment.Nodes {
+			for _, connectionId := range v.Topology.Nodes[nodeId].Inputs {
+				inputs[connectionId] = true
+			}
+		}
+
+		for _, connectionId := range sortedKeys(inputs) {
+			connection := v.Environment.Connections[connectionId]
+			partitions := connection.Partitions
+			if partitions > 0 && replicas.Max > partitions {
+				diagnostics.Warnf(CodeExceedsPartitions, v.EnvironmentSource, joinPath(replicasPath, "max"), "replicas.max %d exceeds the %d partitions of connection %q, so at most %d replicas will receive messages", replicas.Max, partitions, connectionId, partitions)
+			}
+
+			if replicas.LagThreshold == 0 || !isKafkaConnection(connection) {
+				continue
+			}
+
+			// KEDA reads the topic and brokers of a trigger as single values
+			values, _ := ParseConfig(connection.Config)
+			for _, key := range []string{"endpoint", "topic"} {
+				if value, ok := values[key]; ok && !isKedaScalar(value) {
+					diagnostics.Errorf(CodeInvalidConfig, v.EnvironmentSource, joinPath(joinPath(joinPath("connections", connectionId), "config"), key), "%s of connection %q must be a single value for deployment %q to scale on its lag", key, connectionId, deploymentId)
+				}
+			}
+		}
+
+		if replicas.LagThreshold > 0 && len(kafkaTriggers(deploymentId, deployment, v.Topology, v.Environment)) == 0 {
+			diagnostics.Warnf(CodeInvalidReplicas, v.EnvironmentSource, joinPath(replicasPath, "lagThreshold"), "deployment %q reads no Kafka connection with a topic and endpoint, so it scales on CPU instead of lag", deploymentId)
+		}
+	}
+
+	return diagnostics
+}
+
+// Validate runs every static check over the topology and environment and
+// returns all of the problems found rather than stopping at the first one.
+func (v *Validator) Validate() (diagnostics Diagnostics) {
+	diagnostics = append(diagnostics, v.checkTarget()...)
+	diagnostics = append(diagnostics, v.checkConnections()...)
+	diagnostics = append(diagnostics, v.checkDeployments()...)
+	diagnostics = append(diagnostics, v.checkReplicas()...)
+	diagnostics = append(diagnostics, v.checkProcessorEnvs()...)
+	diagnostics = append(diagnostics, v.checkConfigs()...)
+	diagnostics = append(diagnostics, v.checkEnvDefaults()...)
+	diagnostics = append(diagnostics, v.checkProcessorFiles()...)
+	diagnostics = append(diagnostics, v.checkGraph()...)
+
+	return diagnostics
+}
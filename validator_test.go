@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateFixtures(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	diagnostics := builder.Validate()
+	if diagnostics.HasErrors() || diagnostics.HasWarnings() {
+		t.Errorf("expected no problems with fixtures, got: %s", diagnostics)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	builder := NewBuilder("fixtures/invalid-topology.json", "fixtures/invalid-environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	diagnostics := builder.Validate()
+
+	expectedDiagnostics := []string{
+		`fixtures/invalid-topology.json:18:25 nodes.predictArrivals.outputs[0]: unknown connection "estimatedArrivals"`,
+		`fixtures/invalid-environment.json:28:42 deployments.predict-arrivals.nodes[1]: unknown node "predictArival"`,
+		`fixtures/invalid-environment.json:25:41 deployments.write-locations.nodes[1]: node "predictArrivals" is already part of deployment "predict-arrivals"`,
+		`fixtures/invalid-topology.json:20:9 nodes.auditLocations: node "auditLocations" is not part of any deployment`,
+		`fixtures/invalid-environment.json:19:9 processors.predictArival: processor config for unknown node "predictArival"`,
+		`fixtures/invalid-topology.json:24:17 nodes.auditLocations.processor.file: processor file ./processors/auditLocations.js is not readable: stat ./processors/auditLocations.js: no such file or directory`,
+		`fixtures/invalid-topology.json:18:25 nodes.predictArrivals.outputs[0]: connection "estimatedArrivals" is written but never read`,
+		`fixtures/invalid-topology.json:21:24 nodes.auditLocations.inputs[0]: connection "locations" is read but never written, so it must be fed from outside the topology`,
+	}
+
+	if len(diagnostics) != len(expectedDiagnostics) {
+		t.Errorf("expected %d diagnostics, got %d: %s", len(expectedDiagnostics), len(diagnostics), diagnostics)
+	}
+
+	for idx, expectedDiagnostic := range expectedDiagnostics {
+		if idx >= len(diagnostics) {
+			break
+		}
+		if diagnostics[idx].String() != expectedDiagnostic {
+			t.Errorf("diagnostic %d did not match:-->%s<-- vs. -->%s<--", idx, diagnostics[idx], expectedDiagnostic)
+		}
+	}
+}
+
+func TestLoadCollectsErrors(t *testing.T) {
+	builder := NewBuilder("fixtures/missing-topology.json", "fixtures/missing-environment.json")
+	err := builder.Load()
+	if err == nil {
+		t.Errorf("Load should fail when definitions are missing")
+	}
+
+	if len(builder.Diagnostics) != 2 {
+		t.Errorf("expected a diagnostic per missing file, got: %s", builder.Diagnostics)
+	}
+
+	if !builder.Diagnostics.HasCode(CodeIOError) {
+		t.Errorf("expected io-error diagnostics, got: %s", builder.Diagnostics)
+	}
+}
+
+func TestValidateUnknownTarget(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/environment.json")
+	err := builder.Load()
+	if err != nil {
+		t.Errorf("builder failed to load: %s", err)
+	}
+
+	builder.Environment.Target = "nomad"
+	writeLocations := builder.Environment.Deployments["write-locations"]
+	writeLocations.Target = "lambda"
+	builder.Environment.Deployments["write-locations"] = writeLocations
+
+	diagnostics := builder.Validate()
+	if !diagnostics.HasCode(CodeUnknownTarget) {
+		t.Errorf("expected an unknown-target diagnostic, got: %s", diagnostics)
+	}
+
+	expectedDiagnostic := `fixtures/environment.json:2:5 target: unknown target "nomad", expected one of kubernetes, kubernetes-helm, kubernetes-manifests, compose, systemd`
+	if diagnostics[0].String() != expectedDiagnostic {
+		t.Errorf("diagnostic did not match:-->%s<-- vs. -->%s<--", diagnostics[0], expectedDiagnostic)
+	}
+
+	expectedDeploymentDiagnostic := `fixtures/environment.json:39:9 deployments.write-locations.target: unknown target "lambda", expected one of kubernetes, kubernetes-helm, kubernetes-manifests, compose, systemd`
+	if len(diagnostics) < 2 || diagnostics[1].String() != expectedDeploymentDiagnostic {
+		t.Errorf("expected a diagnostic for the deployment target:-->%s<-- in -->%s<--", expectedDeploymentDiagnostic, diagnostics)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Environment strings may contain ${...} expressions that are substituted at
+// build time. ${name} refers to a top level environment field such as tier
+// or namespace, and ${vars.name} to an entry of the vars block, which can be
+// extended by --var-file and overridden by --var on the command line. $${
+// escapes a literal ${.
+const varsKey = "vars"
+
+var variableExpression = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+type interpolator struct {
+	document    map[string]interface{}
+	vars        map[string]interface{}
+	resolving   map[string]bool
+	source      *SourceMap
+	diagnostics Diagnostics
+}
+
+// lookup resolves a variable name to its fully interpolated value.
+func (i *interpolator) lookup(name string, path string) (value interface{}, ok bool) {
+	var raw interface{}
+	if strings.HasPrefix(name, varsKey+".") {
+		raw, ok = i.vars[strings.TrimPrefix(name, varsKey+".")]
+	} else if name != varsKey {
+		raw, ok = i.document[name]
+	}
+
+	if !ok || raw == nil {
+		return nil, false
+	}
+
+	switch raw.(type) {
+	case map[string]interface{}, []interface{}:
+		i.diagnostics.Errorf(CodeInvalidVariable, i.source, path, "${%s} is not a string, number or boolean", name)
+		return "", true
+	}
+
+	if i.resolving[name] {
+		i.diagnostics.Errorf(CodeInvalidVariable, i.source, path, "${%s} refers to itself", name)
+		return "", true
+	}
+
+	i.resolving[name] = true
+	value = i.interpolateScalar(raw, path)
+	delete(i.resolving, name)
+
+	return value, true
+}
+
+// interpolateScalar substitutes the expressions in a string. A string that is
+// a single expression takes on the type of the value it refers to, so that
+// numbers and booleans survive substitution.
+func (i *interpolator) interpolateScalar(value interface{}, path string) interface{} {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	if match := variableExpression.FindStringSubmatchIndex(text); match != nil && match[0] == 0 && match[1] == len(text) && match[2] >= 0 {
+		name := strings.TrimSpace(text[match[2]:match[3]])
+		resolved, ok := i.lookup(name, path)
+		if !ok {
+			i.diagnostics.Errorf(CodeUndefinedVariable, i.source, path, "undefined variable ${%s}", name)
+			return text
+		}
+
+		return resolved
+	}
+
+	return variableExpression.ReplaceAllStringFunc(text, func(expression string) string {
+		if expression == "$${" {
+			return "${"
+		}
+
+		name := strings.TrimSpace(expression[2 : len(expression)-1])
+		resolved, ok := i.lookup(name, path)
+		if !ok {
+			i.diagnostics.Errorf(CodeUndefinedVariable, i.source, path, "undefined variable ${%s}", name)
+			return expression
+		}
+
+		return fmt.Sprint(resolved)
+	})
+}
+
+// interpolate substitutes expressions in every string value and map key
+// beneath value, moving source positions along with renamed keys.
+func (i *interpolator) interpolate(value interface{}, path string) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typedValue))
+		for key := range typedValue {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		interpolated := map[string]interface{}{}
+		for _, key := range keys {
+			memberPath := joinPath(path, key)
+			interpolatedKey := fmt.Sprint(i.interpolateScalar(key, memberPath))
+
+			if interpolatedKey != key {
+				if _, exists := typedValue[interpolatedKey]; exists {
+					i.diagnostics.Errorf(CodeInvalidVariable, i.source, memberPath, "%q becomes %q, which is already defined", key, interpolatedKey)
+					continue
+				}
+
+				memberPath = joinPath(path, interpolatedKey)
+				i.source.Rename(joinPath(path, key), memberPath)
+			}
+
+			interpolated[interpolatedKey] = i.interpolate(typedValue[key], memberPath)
+		}
+
+		return interpolated
+	case []interface{}:
+		interpolated := make([]interface{}, len(typedValue))
+		for idx, item := range typedValue {
+			interpolated[idx] = i.interpolate(item, indexPath(path, idx))
+		}
+
+		return interpolated
+	default:
+		return i.interpolateScalar(value, path)
+	}
+}
+
+// interpolateEnvironment resolves the vars block, var files and command line
+// vars, then substitutes every ${...} expression in the environment document.
+func (b *Builder) interpolateEnvironment(document interface{}, source *SourceMap) (interpolated interface{}, diagnostics Diagnostics) {
+	documentMap, ok := document.(map[string]interface{})
+	if !ok {
+		return document, diagnostics
+	}
+
+	vars := map[string]interface{}{}
+	if documentVars, ok := documentMap[varsKey].(map[string]interface{}); ok {
+		for name, value := range documentVars {
+			vars[name] = value
+		}
+	}
+
+	for _, varFilePath := range b.VariableFiles {
+		fileVars, _, fileDiagnostics := readDefinition(varFilePath)
+		diagnostics = append(diagnostics, fileDiagnostics...)
+		if fileDiagnostics.HasErrors() {
+			continue
+		}
+
+		fileVarsMap, ok := fileVars.(map[string]interface{})
+		if !ok {
+			diagnostics.Errorf(CodeParseError, NewSourceMap(varFilePath), "", "var file must contain a map of variable names to values")
+			continue
+		}
+
+		for name, value := range fileVarsMap {
+			vars[name] = value
+		}
+	}
+
+	for name, value := range b.Variables {
+		vars[name] = value
+	}
+
+	interpolator := &interpolator{
+		document:  documentMap,
+		vars:      vars,
+		resolving: map[string]bool{},
+		source:    source,
+	}
+
+	if len(vars) > 0 {
+		documentMap[varsKey] = vars
+	}
+
+	interpolated = interpolator.interpolate(documentMap, "")
+	diagnostics = append(diagnostics, interpolator.diagnostics...)
+
+	return interpolated, diagnostics
+}
+
+// ParseVariable splits a command line name=value variable.
+func ParseVariable(assignment string) (name string, value string, err error) {
+	parts := strings.SplitN(assignment, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", errors.New(fmt.Sprintf("variable %q must be of the form name=value", assignment))
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Rename moves the positions recorded beneath oldPath to newPath.
+func (s *SourceMap) Rename(oldPath string, newPath string) {
+	positions := map[string]Position{}
+	for path, position := range s.positions {
+		if renamed, ok := renamePath(path, oldPath, newPath); ok {
+			delete(s.positions, path)
+			positions[renamed] = position
+		}
+	}
+	for path, position := range positions {
+		s.positions[path] = position
+	}
+
+	overrides := map[string][]Provenance{}
+	for path, overridden := range s.overrides {
+		if renamed, ok := renamePath(path, oldPath, newPath); ok {
+			delete(s.overrides, path)
+			overrides[renamed] = overridden
+		}
+	}
+	for path, overridden := range overrides {
+		s.overrides[path] = overridden
+	}
+}
+
+func renamePath(path string, oldPath string, newPath string) (string, bool) {
+	if path == oldPath {
+		return newPath, true
+	}
+
+	if strings.HasPrefix(path, oldPath+".") || strings.HasPrefix(path, oldPath+"[") {
+		return newPath + path[len(oldPath):], true
+	}
+
+	return path, false
+}
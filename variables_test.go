@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInterpolateEnvironment(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/templated.yaml")
+	environment, err := builder.LoadEnvironment()
+	if err != nil {
+		t.Errorf("LoadEnvironment did not complete successfully: %s", err)
+	}
+
+	if environment.Tier != "staging" || environment.Namespace != "pipeline-staging" {
+		t.Errorf("top level fields were not interpolated: %s %s", environment.Tier, environment.Namespace)
+	}
+
+	if environment.ContainerRepo != "tpark.azurecr.io/tpark" {
+		t.Errorf("ContainerRepo was not interpolated: %s", environment.ContainerRepo)
+	}
+
+	locations := environment.Connections["locations"].Config
+	if locations["topic"] != "pipeline-staging-locations" || locations["endpoint"] != "kafka-staging" {
+		t.Errorf("connection config was not interpolated: %v", locations)
+	}
+
+	deployment, ok := environment.Deployments["predict-arrivals-staging"]
+	if !ok {
+		t.Errorf("deployment name was not interpolated: %v", environment.Deployments)
+	}
+
+	if deployment.Concurrency != 12 {
+		t.Errorf("numeric variable did not keep its type, got %d", deployment.Concurrency)
+	}
+
+	if deployment.LogSeverity != "${not-a-variable}" {
+		t.Errorf("escaped expression was not left literal, got %s", deployment.LogSeverity)
+	}
+
+	position := builder.EnvironmentSource.LocatePosition("deployments.predict-arrivals-staging.concurrency")
+	if position.File != "fixtures/overlays/templated.yaml" || position.Line != 22 {
+		t.Errorf("renamed deployment located at %s:%d", position.File, position.Line)
+	}
+}
+
+func TestInterpolateCommandLineVariables(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/templated.yaml")
+	builder.VariableFiles = []string{"fixtures/overlays/vars.yaml"}
+	builder.Variables = map[string]interface{}{"tier": "qa"}
+
+	environment, err := builder.LoadEnvironment()
+	if err != nil {
+		t.Errorf("LoadEnvironment did not complete successfully: %s", err)
+	}
+
+	if environment.Namespace != "pipeline-qa" {
+		t.Errorf("--var did not override the vars block, got %s", environment.Namespace)
+	}
+
+	if environment.ContainerRepo != "registry.example.com/tpark" {
+		t.Errorf("--var-file did not override the vars block, got %s", environment.ContainerRepo)
+	}
+
+	if environment.Connections["locations"].Config["endpoint"] != "registry.example.com-kafka" {
+		t.Errorf("var file variables were not interpolated, got %v", environment.Connections["locations"].Config["endpoint"])
+	}
+}
+
+func TestInterpolateUndefinedVariable(t *testing.T) {
+	builder := NewBuilder("fixtures/topology.json", "fixtures/overlays/templated.yaml")
+	builder.Variables = map[string]interface{}{"kafkaCluster": "${vars.cluster}"}
+
+	_, err := builder.LoadEnvironment()
+	if err == nil {
+		t.Errorf("LoadEnvironment should fail on an undefined variable")
+	}
+
+	if !builder.Diagnostics.HasCode(CodeUndefinedVariable) {
+		t.Errorf("expected an undefined-variable diagnostic, got: %s", builder.Diagnostics)
+	}
+
+	diagnostic := builder.Diagnostics[0]
+	if diagnostic.Path != "connections.locations.config.endpoint" || diagnostic.Line != 16 {
+		t.Errorf("undefined variable was not positioned: %s", diagnostic)
+	}
+}